@@ -0,0 +1,155 @@
+// Package downloadtest provides test doubles for the ipsw.me client of package download
+package downloadtest
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/blacktop/ipsw/internal/download"
+)
+
+// FakeAPI is an in-memory download.API serving the devices, releases and OTAs it is populated with
+//
+// Lookups of unknown devices or builds fail with a 404 *download.StatusError like the real API.
+type FakeAPI struct {
+	// Devices are the devices with their firmwares
+	Devices []download.Device
+	// Releases are returned as is by GetReleases
+	Releases []download.Release
+	// OTAs are the OTAs keyed by device identifier
+	OTAs map[string][]download.OTA
+	// Err is returned by every method when set
+	Err error
+}
+
+var _ download.API = (*FakeAPI)(nil)
+
+func notFound(sentinel error, format string, args ...any) error {
+	return fmt.Errorf("%w: %s: %w", sentinel, fmt.Sprintf(format, args...), &download.StatusError{
+		StatusCode: http.StatusNotFound,
+		Status:     "404 Not Found",
+	})
+}
+
+func (f *FakeAPI) device(identifier string) (download.Device, error) {
+	identifier = download.NormalizeIdentifier(identifier)
+	for _, d := range f.Devices {
+		if d.Identifier == identifier {
+			return d, nil
+		}
+	}
+	return download.Device{}, notFound(download.ErrDeviceNotFound, "device %s", identifier)
+}
+
+func (f *FakeAPI) firmwares() []download.IPSW {
+	var ipsws []download.IPSW
+	for _, d := range f.Devices {
+		ipsws = append(ipsws, d.Firmwares...)
+	}
+	return ipsws
+}
+
+// GetAllDevices returns the devices without their firmwares like the catalog endpoint
+func (f *FakeAPI) GetAllDevices(opts ...download.ClientOption) ([]download.Device, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	devices := make([]download.Device, 0, len(f.Devices))
+	for _, d := range f.Devices {
+		d.Firmwares = nil
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+// GetDevice returns a device from its identifier
+func (f *FakeAPI) GetDevice(identifier string, opts ...download.ClientOption) (download.Device, error) {
+	if f.Err != nil {
+		return download.Device{}, f.Err
+	}
+	d, err := f.device(identifier)
+	d.Firmwares = slices.Clone(d.Firmwares)
+	return d, err
+}
+
+// GetDeviceIPSWs returns a device's IPSWs from its identifier
+func (f *FakeAPI) GetDeviceIPSWs(identifier string, opts ...download.ClientOption) ([]download.IPSW, error) {
+	d, err := f.GetDevice(identifier)
+	if err != nil {
+		return nil, err
+	}
+	return d.Firmwares, nil
+}
+
+// GetAllIPSW returns every device's IPSWs of a version
+func (f *FakeAPI) GetAllIPSW(version string, opts ...download.ClientOption) ([]download.IPSW, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	ipsws := []download.IPSW{}
+	for _, i := range f.firmwares() {
+		if i.Version == version {
+			ipsws = append(ipsws, i)
+		}
+	}
+	return ipsws, nil
+}
+
+// GetIPSW returns a device's IPSW of a build
+func (f *FakeAPI) GetIPSW(identifier, buildID string, opts ...download.ClientOption) (download.IPSW, error) {
+	ipsws, err := f.GetDeviceIPSWs(identifier)
+	if err != nil {
+		return download.IPSW{}, err
+	}
+	for _, i := range ipsws {
+		if i.BuildID == buildID {
+			return i, nil
+		}
+	}
+	return download.IPSW{}, notFound(download.ErrBuildNotFound, "build %s of device %s", buildID, identifier)
+}
+
+// GetVersion returns the version of a build, from the newest device listing it like the Client
+func (f *FakeAPI) GetVersion(buildID string, opts ...download.ClientOption) (string, error) {
+	return download.VersionForBuild(f, buildID)
+}
+
+// GetBuildID returns the build ID of a device's version
+func (f *FakeAPI) GetBuildID(version, identifier string, opts ...download.ClientOption) (string, error) {
+	if f.Err != nil {
+		return "", f.Err
+	}
+	identifier = download.NormalizeIdentifier(identifier)
+	for _, i := range f.firmwares() {
+		if i.Identifier == identifier && i.Version == version {
+			return i.BuildID, nil
+		}
+	}
+	return "", fmt.Errorf("%w for version %s and device %s", download.ErrBuildNotFound, version, identifier)
+}
+
+// GetReleases returns the releases
+func (f *FakeAPI) GetReleases(opts ...download.ClientOption) ([]download.Release, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return slices.Clone(f.Releases), nil
+}
+
+// GetDeviceOTAs returns a device's OTAs from its identifier
+func (f *FakeAPI) GetDeviceOTAs(identifier string, opts ...download.ClientOption) ([]download.OTA, error) {
+	if _, err := f.GetDevice(identifier); err != nil {
+		return nil, err
+	}
+	return slices.Clone(f.OTAs[download.NormalizeIdentifier(identifier)]), nil
+}
+
+// IsBuildSigned returns whether a device's build is signed
+func (f *FakeAPI) IsBuildSigned(identifier, buildID string) (bool, error) {
+	i, err := f.GetIPSW(identifier, buildID)
+	if err != nil {
+		return false, err
+	}
+	return i.Signed, nil
+}
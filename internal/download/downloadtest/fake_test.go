@@ -0,0 +1,82 @@
+package downloadtest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/blacktop/ipsw/internal/download"
+)
+
+func TestFakeAPIDerivedLookups(t *testing.T) {
+	api := &FakeAPI{
+		Devices: []download.Device{
+			{Identifier: "iPhone12,8", Firmwares: []download.IPSW{
+				{Identifier: "iPhone12,8", Version: "16.3", BuildID: "20D47"},
+				{Identifier: "iPhone12,8", Version: "15.0", BuildID: "19A346"},
+			}},
+			{Identifier: "iPhone14,6", Firmwares: []download.IPSW{
+				{Identifier: "iPhone14,6", Version: "16.3", BuildID: "20D47"},
+			}},
+		},
+	}
+
+	pairs, err := download.CompatiblePairs(api)
+	if err != nil {
+		t.Fatalf("CompatiblePairs() error = %v", err)
+	}
+	if len(pairs) != 1 || pairs[0].Version != "16.3" {
+		t.Errorf("CompatiblePairs() = %+v, want only 16.3", pairs)
+	}
+
+	if i, err := download.EquivalentIPSW(api, "iPhone12,8", "iPhone14,6", "16.3.0"); err != nil || i.BuildID != "20D47" {
+		t.Errorf("EquivalentIPSW() = %v, %v, want 20D47", i, err)
+	}
+	if _, err := download.EquivalentIPSW(api, "iPhone12,8", "iPhone14,6", "15.0"); !errors.Is(err, download.ErrBuildNotFound) {
+		t.Errorf("EquivalentIPSW() error = %v, want %v", err, download.ErrBuildNotFound)
+	}
+
+	api.Err = errors.New("offline")
+	if _, err := download.CompatibleIPSWs(api, "16.3"); err == nil {
+		t.Error("CompatibleIPSWs() error = nil, want the API error")
+	}
+}
+
+func TestVersionForBuild(t *testing.T) {
+	api := &FakeAPI{
+		Devices: []download.Device{
+			{Identifier: "iPhone9,1", Firmwares: []download.IPSW{
+				{Identifier: "iPhone9,1", Version: "16.3.0", BuildID: "20D47"},
+			}},
+			{Identifier: "iPhone15,2", Firmwares: []download.IPSW{
+				{Identifier: "iPhone15,2", Version: "16.3", BuildID: "20D47"},
+			}},
+			{Identifier: "iPhone14,6", Firmwares: []download.IPSW{
+				{Identifier: "iPhone14,6", Version: "16.2", BuildID: "20C65"},
+			}},
+		},
+	}
+
+	tests := []struct {
+		buildID string
+		want    string
+		wantErr error
+	}{
+		{"20D47", "16.3", nil},
+		{"20C65", "16.2", nil},
+		{"99A1", "", download.ErrVersionNotFound},
+	}
+	for _, tt := range tests {
+		got, err := download.VersionForBuild(api, tt.buildID)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("VersionForBuild(%s) = %q, %v, want %q, %v", tt.buildID, got, err, tt.want, tt.wantErr)
+		}
+		if got, err := api.GetVersion(tt.buildID); !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("GetVersion(%s) = %q, %v, want %q, %v", tt.buildID, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	api.Err = errors.New("offline")
+	if _, err := download.VersionForBuild(api, "20D47"); !errors.Is(err, api.Err) {
+		t.Errorf("VersionForBuild() error = %v, want %v", err, api.Err)
+	}
+}
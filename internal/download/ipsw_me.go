@@ -1,10 +1,20 @@
 package download
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -12,13 +22,22 @@ const ipswMeAPI = "https://api.ipsw.me/v4/"
 
 // Device struct
 type Device struct {
-	Name        string `json:"name,omitempty"`
-	Identifier  string `json:"identifier,omitempty"`
+	Name        string  `json:"name,omitempty"`
+	Identifier  string  `json:"identifier,omitempty"`
+	BoardConfig string  `json:"boardconfig,omitempty"`
+	Platform    string  `json:"platform,omitempty"`
+	CpID        int     `json:"cpid,omitempty"`
+	BdID        int     `json:"bdid,omitempty"`
+	Boards      []Board `json:"boards,omitempty"`
+	Firmwares   []IPSW  `json:"firmwares,omitempty"`
+}
+
+// Board struct
+type Board struct {
 	BoardConfig string `json:"boardconfig,omitempty"`
 	Platform    string `json:"platform,omitempty"`
 	CpID        int    `json:"cpid,omitempty"`
 	BdID        int    `json:"bdid,omitempty"`
-	Firmwares   []IPSW `json:"firmwares,omitempty"`
 }
 
 // IPSW struct
@@ -28,13 +47,65 @@ type IPSW struct {
 	BuildID     string    `json:"buildid,omitempty"`
 	SHA1        string    `json:"sha1sum,omitempty"`
 	MD5         string    `json:"md5sum,omitempty"`
-	FileSize    int       `json:"filesize,omitempty"`
+	FileSize    int64     `json:"filesize,omitempty"`
 	URL         string    `json:"url,omitempty"`
 	ReleaseDate time.Time `json:"releasedate"`
 	UploadDate  time.Time `json:"uploaddate"`
 	Signed      bool      `json:"signed,omitempty"`
 }
 
+func (d Device) String() string {
+	switch {
+	case d.Name != "" && d.Identifier != "":
+		return fmt.Sprintf("%s (%s)", d.Name, d.Identifier)
+	case d.Name != "":
+		return d.Name
+	default:
+		return d.Identifier
+	}
+}
+
+func (i IPSW) String() string {
+	var parts []string
+	if i.Identifier != "" {
+		parts = append(parts, i.Identifier)
+	}
+	if i.Version != "" {
+		parts = append(parts, i.Version)
+	}
+	if i.BuildID != "" {
+		parts = append(parts, "("+i.BuildID+")")
+	}
+	if i.Signed {
+		parts = append(parts, "[signed]")
+	}
+	return strings.Join(parts, " ")
+}
+
+// IsSigned returns whether Apple was signing the IPSW when it was fetched
+func (i IPSW) IsSigned() bool {
+	return i.Signed
+}
+
+// IsDownloadable returns whether the IPSW's artifact is available, pre-release builds can have
+// metadata before their file is published
+func (i IPSW) IsDownloadable() bool {
+	return i.URL != "" && i.FileSize > 0
+}
+
+// Age returns how long ago the IPSW was released according to the DefaultClient's clock (see WithClock),
+// or 0 if its release date is unknown
+func (i IPSW) Age() time.Duration {
+	return age(i.ReleaseDate)
+}
+
+func age(t time.Time) time.Duration {
+	if t.IsZero() {
+		return 0
+	}
+	return DefaultClient().now().Sub(t)
+}
+
 // iPhone SE2/SE3 device identifiers
 const (
 	iPhoneSE2Identifier = "iPhone12,8" // iPhone SE (2nd generation)
@@ -48,90 +119,304 @@ type DeviceMapping struct {
 	Compatible    bool   `json:"compatible"`
 }
 
+// DevicePair is a source device and the equivalent target device whose firmwares match it
+type DevicePair struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// DeviceMap pairs devices whose firmwares are interchangeable for porting purposes
+type DeviceMap struct {
+	Pairs []DevicePair `json:"pairs"`
+}
+
+// DefaultDeviceMap is the DeviceMap of the known equivalent devices
+var DefaultDeviceMap = DeviceMap{
+	Pairs: []DevicePair{
+		{Source: iPhoneSE2Identifier, Target: iPhoneSE3Identifier},
+	},
+}
+
+// Target returns the device paired with source
+func (m DeviceMap) Target(source string) (string, bool) {
+	for _, p := range m.Pairs {
+		if p.Source == source {
+			return p.Target, true
+		}
+	}
+	return "", false
+}
+
+// IsSource returns whether identifier is the source of a pair
+func (m DeviceMap) IsSource(identifier string) bool {
+	return slices.ContainsFunc(m.Pairs, func(p DevicePair) bool { return p.Source == identifier })
+}
+
+// IsTarget returns whether identifier is the target of a pair
+func (m DeviceMap) IsTarget(identifier string) bool {
+	return slices.ContainsFunc(m.Pairs, func(p DevicePair) bool { return p.Target == identifier })
+}
+
+// GetAllDevices returns a list of all devices
+func GetAllDevices(opts ...ClientOption) ([]Device, error) {
+	return DefaultClient().GetAllDevices(opts...)
+}
+
 // GetAllDevices returns a list of all devices
-func GetAllDevices() ([]Device, error) {
+func (c *Client) GetAllDevices(opts ...ClientOption) ([]Device, error) {
+	return c.with(opts).getAllDevices(context.Background())
+}
+
+func (c *Client) getAllDevices(ctx context.Context) ([]Device, error) {
 	devices := []Device{}
 
-	res, err := http.Get(ipswMeAPI + "devices")
-	if err != nil {
+	if err := c.getJSON(ctx, "devices", &devices); err != nil {
 		return devices, err
 	}
-	defer res.Body.Close()
-	
-	if res.StatusCode != http.StatusOK {
-		return devices, fmt.Errorf("api returned status: %s", res.Status)
-	}
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return devices, err
+	return c.tidyDevices(devices), nil
+}
+
+// tidyDevices applies the WithDedupe and WithSort options to a device list
+func (c *Client) tidyDevices(devices []Device) []Device {
+	if c.dedupeDevices {
+		var dups []string
+		devices, dups = dedupeDevices(devices)
+		if len(dups) > 0 {
+			c.logger.WithField("identifiers", strings.Join(dups, ", ")).Warn("ipsw.me API returned duplicate devices")
+		}
 	}
 
-	err = json.Unmarshal(body, &devices)
-	if err != nil {
-		return devices, err
+	if c.sortDevices {
+		SortDevices(devices, c.deviceSortKey)
 	}
 
-	return devices, nil
+	return devices
 }
 
-// GetDevice returns a device from its identifier
-func GetDevice(identifier string) (Device, error) {
-	d := Device{}
+// GetDevicesByPlatform returns the devices of a platform (e.g. "appletvos") using the DefaultClient
+func GetDevicesByPlatform(platform string, opts ...ClientOption) ([]Device, error) {
+	return DefaultClient().GetDevicesByPlatform(platform, opts...)
+}
 
-	res, err := http.Get(ipswMeAPI + "device/" + identifier)
+// GetDevicesByPlatform returns the devices of a platform (e.g. "iphoneos", "appletvos"), matched case-insensitively
+func (c *Client) GetDevicesByPlatform(platform string, opts ...ClientOption) ([]Device, error) {
+	devices, err := c.GetAllDevices(opts...)
 	if err != nil {
-		return d, err
+		return nil, err
 	}
-	defer res.Body.Close()
-	
-	if res.StatusCode != http.StatusOK {
-		return d, fmt.Errorf("api returned status: %s", res.Status)
+
+	matching := []Device{}
+	for _, d := range devices {
+		if strings.EqualFold(d.Platform, platform) {
+			matching = append(matching, d)
+		}
 	}
 
-	body, err := io.ReadAll(res.Body)
+	return matching, nil
+}
+
+// GetDeviceByBoardConfig returns the device with a board config (e.g. "d321ap") using the DefaultClient
+func GetDeviceByBoardConfig(boardConfig string, opts ...ClientOption) (Device, error) {
+	return DefaultClient().GetDeviceByBoardConfig(boardConfig, opts...)
+}
+
+// GetDeviceByBoardConfig returns the device with a board config (e.g. "d321ap"), matched case-insensitively
+// against each device's primary board config and the boards listed for it, or ErrDeviceNotFound
+func (c *Client) GetDeviceByBoardConfig(boardConfig string, opts ...ClientOption) (Device, error) {
+	devices, err := c.GetAllDevices(opts...)
 	if err != nil {
-		return d, err
+		return Device{}, err
 	}
 
-	err = json.Unmarshal(body, &d)
-	if err != nil {
-		return d, err
+	for _, d := range devices {
+		if strings.EqualFold(d.BoardConfig, boardConfig) ||
+			slices.ContainsFunc(d.Boards, func(b Board) bool { return strings.EqualFold(b.BoardConfig, boardConfig) }) {
+			return d, nil
+		}
+	}
+
+	return Device{}, fmt.Errorf("%w: no device with board config %s", ErrDeviceNotFound, boardConfig)
+}
+
+// GetDevice returns a device from its identifier
+func GetDevice(identifier string, opts ...ClientOption) (Device, error) {
+	return DefaultClient().GetDevice(identifier, opts...)
+}
+
+// GetDevice returns a device from its identifier
+func (c *Client) GetDevice(identifier string, opts ...ClientOption) (Device, error) {
+	c = c.with(opts)
+	return c.getDevice(context.Background(), identifier)
+}
+
+func (c *Client) getDevice(ctx context.Context, identifier string) (d Device, err error) {
+	identifier = NormalizeIdentifier(identifier)
+	ctx, span := c.startSpan(ctx, "GetDevice", attrIdentifier.String(identifier))
+	defer func() { endSpan(span, err) }()
+
+	err = c.getJSON(ctx, "device/"+identifier, &d)
+	switch {
+	case isNotFound(err):
+		err = fmt.Errorf("%w: %s: %w", ErrDeviceNotFound, identifier, err)
+	case err == nil && d.Identifier == "":
+		// a device without an identifier is as good as an empty response
+		err = fmt.Errorf("%w: device/%s returned a device without an identifier", ErrEmptyResponse, identifier)
 	}
+	return d, err
+}
 
-	return d, nil
+// GetDeviceIPSWs returns a device's IPSWs from its identifier
+func GetDeviceIPSWs(identifier string, opts ...ClientOption) ([]IPSW, error) {
+	return DefaultClient().GetDeviceIPSWs(identifier, opts...)
 }
 
 // GetDeviceIPSWs returns a device's IPSWs from its identifier
-func GetDeviceIPSWs(identifier string) ([]IPSW, error) {
-	d, err := GetDevice(identifier)
+func (c *Client) GetDeviceIPSWs(identifier string, opts ...ClientOption) ([]IPSW, error) {
+	c = c.with(opts)
+	d, err := c.GetDevice(identifier)
 	if err != nil {
 		return nil, err
 	}
 	return d.Firmwares, nil
 }
 
-// GetAllIPSW finds all IPSW files for a given iOS version
-func GetAllIPSW(version string) ([]IPSW, error) {
-	ipsws := []IPSW{}
+// GetSignedIPSWs returns a device's currently signed IPSWs from its identifier
+func GetSignedIPSWs(identifier string, opts ...ClientOption) ([]IPSW, error) {
+	return DefaultClient().GetSignedIPSWs(identifier, opts...)
+}
 
-	res, err := http.Get(ipswMeAPI + "ipsw/" + version)
+// GetSignedIPSWs returns a device's currently signed IPSWs from its identifier,
+// an empty slice if none are signed
+func (c *Client) GetSignedIPSWs(identifier string, opts ...ClientOption) ([]IPSW, error) {
+	ipsws, err := c.GetDeviceIPSWs(identifier, opts...)
 	if err != nil {
-		return ipsws, err
+		return nil, err
 	}
-	defer res.Body.Close()
-	
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("api returned status: %s", res.Status)
+
+	signed := []IPSW{}
+	for _, i := range ipsws {
+		if i.IsSigned() {
+			signed = append(signed, i)
+		}
+	}
+
+	return signed, nil
+}
+
+// VersionRange is an inclusive range of versions, a zero Max means no upper bound
+type VersionRange struct {
+	Min Version
+	Max Version
+}
+
+// Contains returns whether v is within the range
+func (r VersionRange) Contains(v Version) bool {
+	if v.Less(r.Min) {
+		return false
 	}
+	return r.Max == (Version{}) || !r.Max.Less(v)
+}
+
+// IPSWListOptions filters the IPSWs returned by GetDeviceIPSWsOpts, the zero value returns only
+// signed and downloadable IPSWs of any version
+type IPSWListOptions struct {
+	// IncludeUnsigned also returns IPSWs Apple is no longer signing
+	IncludeUnsigned bool
+	// IncludePulled also returns IPSWs without a URL (pulled or not yet published)
+	IncludePulled bool
+	// VersionRange only returns IPSWs whose version is in the range (and parses) when set
+	VersionRange *VersionRange
+}
+
+// IncludeAllIPSWs is the IPSWListOptions returning every IPSW unfiltered
+var IncludeAllIPSWs = IPSWListOptions{IncludeUnsigned: true, IncludePulled: true}
+
+// GetDeviceIPSWsOpts returns a device's IPSWs filtered by opts using the DefaultClient
+func GetDeviceIPSWsOpts(identifier string, opts IPSWListOptions) ([]IPSW, error) {
+	return DefaultClient().GetDeviceIPSWsOpts(identifier, opts)
+}
 
-	body, err := io.ReadAll(res.Body)
+// GetDeviceIPSWsOpts returns a device's IPSWs filtered by opts, every filter must pass for an IPSW to be returned
+func (c *Client) GetDeviceIPSWsOpts(identifier string, opts IPSWListOptions) ([]IPSW, error) {
+	ipsws, err := c.GetDeviceIPSWs(identifier)
 	if err != nil {
-		return ipsws, err
+		return nil, err
 	}
 
-	err = json.Unmarshal(body, &ipsws)
+	filtered := []IPSW{}
+	for _, i := range ipsws {
+		if !opts.IncludeUnsigned && !i.Signed {
+			continue
+		}
+		if !opts.IncludePulled && i.URL == "" {
+			continue
+		}
+		if opts.VersionRange != nil {
+			v, err := ParseVersion(i.Version)
+			if err != nil || !opts.VersionRange.Contains(v) {
+				continue
+			}
+		}
+		filtered = append(filtered, i)
+	}
+
+	return filtered, nil
+}
+
+// FilterIPSWsByBuildPrefix returns the IPSWs whose build ID starts with prefix (case-insensitive),
+// e.g. 21C for every build of a build train
+func FilterIPSWsByBuildPrefix(ipsws []IPSW, prefix string) []IPSW {
+	prefix = strings.ToUpper(prefix)
+	filtered := []IPSW{}
+	for _, i := range ipsws {
+		if strings.HasPrefix(strings.ToUpper(i.BuildID), prefix) {
+			filtered = append(filtered, i)
+		}
+	}
+	return filtered
+}
+
+// FilterIPSWsBySize returns the IPSWs whose file size is within minBytes and maxBytes inclusive,
+// a maxBytes of 0 means no upper bound
+func FilterIPSWsBySize(ipsws []IPSW, minBytes, maxBytes int64) []IPSW {
+	filtered := []IPSW{}
+	for _, i := range ipsws {
+		if i.FileSize >= minBytes && (maxBytes <= 0 || i.FileSize <= maxBytes) {
+			filtered = append(filtered, i)
+		}
+	}
+	return filtered
+}
+
+// GetDeviceIPSWsByBuildPrefix returns a device's IPSWs whose build ID starts with prefix using the DefaultClient
+func GetDeviceIPSWsByBuildPrefix(identifier, prefix string) ([]IPSW, error) {
+	return DefaultClient().GetDeviceIPSWsByBuildPrefix(identifier, prefix)
+}
+
+// GetDeviceIPSWsByBuildPrefix returns a device's IPSWs whose build ID starts with prefix, see FilterIPSWsByBuildPrefix
+func (c *Client) GetDeviceIPSWsByBuildPrefix(identifier, prefix string) ([]IPSW, error) {
+	ipsws, err := c.GetDeviceIPSWs(identifier)
 	if err != nil {
+		return nil, err
+	}
+	return FilterIPSWsByBuildPrefix(ipsws, prefix), nil
+}
+
+// GetAllIPSW finds all IPSW files for a given iOS version
+func GetAllIPSW(version string, opts ...ClientOption) ([]IPSW, error) {
+	return DefaultClient().GetAllIPSW(version, opts...)
+}
+
+// GetAllIPSW finds all IPSW files for a given iOS version
+func (c *Client) GetAllIPSW(version string, opts ...ClientOption) ([]IPSW, error) {
+	return c.with(opts).getAllIPSW(context.Background(), version)
+}
+
+func (c *Client) getAllIPSW(ctx context.Context, version string) ([]IPSW, error) {
+	ipsws := []IPSW{}
+
+	if err := c.getJSON(ctx, "ipsw/"+version, &ipsws); err != nil {
 		return ipsws, err
 	}
 
@@ -139,102 +424,265 @@ func GetAllIPSW(version string) ([]IPSW, error) {
 }
 
 // GetIPSW will get an IPSW when supplied an identifier and build ID
-func GetIPSW(identifier, buildID string) (IPSW, error) {
-	i := IPSW{}
+func GetIPSW(identifier, buildID string, opts ...ClientOption) (IPSW, error) {
+	return DefaultClient().GetIPSW(identifier, buildID, opts...)
+}
 
-	res, err := http.Get(ipswMeAPI + "ipsw/" + identifier + "/" + buildID)
-	if err != nil {
-		return i, err
-	}
-	defer res.Body.Close()
+// GetIPSW will get an IPSW when supplied an identifier and build ID
+//
+// If the direct lookup 404s the device's firmware list is searched for the build instead.
+func (c *Client) GetIPSW(identifier, buildID string, opts ...ClientOption) (IPSW, error) {
+	return c.with(opts).getIPSW(context.Background(), identifier, buildID)
+}
 
-	if res.StatusCode != http.StatusOK {
-		return i, fmt.Errorf("api returned status: %s", res.Status)
-	}
+func (c *Client) getIPSW(ctx context.Context, identifier, buildID string) (i IPSW, err error) {
+	identifier = NormalizeIdentifier(identifier)
+	ctx, span := c.startSpan(ctx, "GetIPSW", attrIdentifier.String(identifier), attrBuild.String(buildID))
+	defer func() { endSpan(span, err) }()
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return i, err
-	}
+	err = c.getJSON(ctx, "ipsw/"+identifier+"/"+buildID, &i)
 
-	err = json.Unmarshal(body, &i)
-	if err != nil {
-		return i, err
+	if isNotFound(err) {
+		// the direct lookup 404s for some builds that are still in the device's firmware list
+		if d, ferr := c.getDevice(ctx, identifier); ferr == nil {
+			for _, fw := range d.Firmwares {
+				if fw.BuildID == buildID {
+					return fw, nil
+				}
+			}
+		}
+		err = fmt.Errorf("%w: %s for device %s: %w", ErrBuildNotFound, buildID, identifier, err)
 	}
 
-	return i, nil
+	return i, err
+}
+
+// GetVersion returns the iOS version for a given build ID
+func GetVersion(buildID string, opts ...ClientOption) (string, error) {
+	return DefaultClient().GetVersion(buildID, opts...)
 }
 
 // GetVersion returns the iOS version for a given build ID
-func GetVersion(buildID string) (string, error) {
-	devices, err := GetAllDevices()
+//
+// Devices are fetched concurrently (see WithMaxConcurrency) from the newest generation down, when several
+// devices list the build the newest one (by identifier generation, see compareIdentifiers) wins.
+// If no device lists the build the error wraps ErrVersionNotFound along with the errors of the devices
+// that couldn't be fetched.
+func (c *Client) GetVersion(buildID string, opts ...ClientOption) (string, error) {
+	return VersionForBuild(c.with(opts), buildID)
+}
+
+// VersionForBuild is GetVersion on top of any API, e.g. a downloadtest.FakeAPI in tests
+//
+// A *Client fetches with its own concurrency and cancels the requests that are no longer needed,
+// other APIs are fetched with the DefaultClient's concurrency.
+func VersionForBuild(api API, buildID string) (string, error) {
+	concurrency := DefaultClient().maxConcurrency
+	getDevice := func(_ context.Context, identifier string) (Device, error) { return api.GetDevice(identifier) }
+	if c, ok := api.(*Client); ok {
+		concurrency, getDevice = c.maxConcurrency, c.getDevice
+	}
+
+	devices, err := api.GetAllDevices()
 	if err != nil {
-		return "", fmt.Errorf("failed to get all devices from ipsw.me API: %v", err)
+		return "", fmt.Errorf("failed to get all devices from ipsw.me API: %w", err)
 	}
+	devices = slices.Clone(devices)
+	slices.SortStableFunc(devices, func(a, b Device) int { return compareIdentifiers(b.Identifier, a.Identifier) })
 
-	for i := len(devices) - 1; i >= 0; i-- {
-		var dev Device
-		res, err := http.Get(ipswMeAPI + "device/" + devices[i].Identifier)
-		if err != nil {
-			continue // Skip on error and try next device
-		}
-		
-		if res.StatusCode != http.StatusOK {
-			res.Body.Close()
-			continue
-		}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-		body, err := io.ReadAll(res.Body)
-		res.Body.Close()
-		if err != nil {
-			continue
-		}
+	var mu sync.Mutex
+	var errs []error
+	best := len(devices)
+	version := ""
+	done := make([]bool, len(devices))
 
-		err = json.Unmarshal(body, &dev)
-		if err != nil {
-			continue
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(concurrency, 1))
+	// a match cancels the remaining requests once every newer device is done
+	for idx := range devices {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
 		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			dev, err := getDevice(ctx, devices[idx].Identifier)
 
-		for _, ipsw := range dev.Firmwares {
-			if ipsw.BuildID == buildID {
-				return ipsw.Version, nil
+			mu.Lock()
+			defer mu.Unlock()
+			done[idx] = true
+			switch {
+			case err != nil:
+				if ctx.Err() == nil {
+					errs = append(errs, fmt.Errorf("failed to get %s: %w", devices[idx].Identifier, err))
+				}
+			case idx < best:
+				for _, ipsw := range dev.Firmwares {
+					if ipsw.BuildID == buildID {
+						best, version = idx, ipsw.Version
+						break
+					}
+				}
+			}
+			if best < len(devices) && !slices.Contains(done[:best], false) {
+				cancel()
 			}
+		}()
+	}
+	wg.Wait()
+
+	if best == len(devices) {
+		if len(errs) > 0 {
+			return "", fmt.Errorf("%w for build %s in the ipsw.me API: %w", ErrVersionNotFound, buildID, errors.Join(errs...))
 		}
+		return "", fmt.Errorf("%w for build %s in the ipsw.me API", ErrVersionNotFound, buildID)
 	}
+	return version, nil
+}
 
-	return "", fmt.Errorf("build did not match a version in the ipsw.me API")
+// GetBuildID returns the BuildID for a given version and identifier
+func GetBuildID(version, identifier string, opts ...ClientOption) (string, error) {
+	return DefaultClient().GetBuildID(version, identifier, opts...)
 }
 
 // GetBuildID returns the BuildID for a given version and identifier
-func GetBuildID(version, identifier string) (string, error) {
+func (c *Client) GetBuildID(version, identifier string, opts ...ClientOption) (string, error) {
+	c = c.with(opts)
+	identifier = NormalizeIdentifier(identifier)
 	var ipsws []IPSW
 
-	res, err := http.Get(ipswMeAPI + "ipsw/" + version)
-	if err != nil {
+	if err := c.getJSON(context.Background(), "ipsw/"+version, &ipsws); err != nil {
 		return "", err
 	}
-	defer res.Body.Close()
-	
-	if res.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("api returned status: %s", res.Status)
+
+	for _, i := range ipsws {
+		if i.Identifier == identifier {
+			return i.BuildID, nil
+		}
 	}
+	return "", fmt.Errorf("%w for version %s and device %s", ErrBuildNotFound, version, identifier)
+}
+
+// GetBuildIDsForVersion returns the build IDs of a version and the devices using them using the DefaultClient
+func GetBuildIDsForVersion(version string) (map[string][]string, error) {
+	return DefaultClient().GetBuildIDsForVersion(version)
+}
 
-	body, err := io.ReadAll(res.Body)
+// GetBuildIDsForVersion returns the build IDs a version shipped as, each with the sorted identifiers
+// of the devices using it, which shows when device families got different builds of the same version
+func (c *Client) GetBuildIDsForVersion(version string) (map[string][]string, error) {
+	ipsws, err := c.GetAllIPSW(version)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	err = json.Unmarshal(body, &ipsws)
-	if err != nil {
+	builds := make(map[string][]string)
+	for _, i := range ipsws {
+		if !slices.Contains(builds[i.BuildID], i.Identifier) {
+			builds[i.BuildID] = append(builds[i.BuildID], i.Identifier)
+		}
+	}
+	for _, identifiers := range builds {
+		slices.Sort(identifiers)
+	}
+
+	return builds, nil
+}
+
+// GetNewestBuildForVersion returns the canonical build ID of a version across devices using the DefaultClient
+func GetNewestBuildForVersion(version string) (string, error) {
+	return DefaultClient().GetNewestBuildForVersion(version)
+}
+
+// GetNewestBuildForVersion returns the canonical build ID of a version regardless of device, as device
+// families occasionally get different builds of the same version
+//
+// The build used by the most devices wins, ties are broken by the newest upload date and then by the
+// highest build ID. ErrVersionNotFound is returned when the version has no IPSWs.
+func (c *Client) GetNewestBuildForVersion(version string) (string, error) {
+	ipsws, err := c.GetAllIPSW(version)
+	if isNotFound(err) {
+		return "", fmt.Errorf("%w: %s: %w", ErrVersionNotFound, version, err)
+	} else if err != nil {
 		return "", err
 	}
 
+	type build struct {
+		id       string
+		devices  int
+		uploaded time.Time
+	}
+	var builds []*build
+	byID := make(map[string]*build)
 	for _, i := range ipsws {
-		if i.Identifier == identifier {
-			return i.BuildID, nil
+		b, ok := byID[i.BuildID]
+		if !ok {
+			b = &build{id: i.BuildID}
+			byID[i.BuildID] = b
+			builds = append(builds, b)
 		}
+		b.devices++
+		if i.UploadDate.After(b.uploaded) {
+			b.uploaded = i.UploadDate
+		}
+	}
+	if len(builds) == 0 {
+		return "", fmt.Errorf("%w: %s has no IPSWs", ErrVersionNotFound, version)
 	}
-	return "", fmt.Errorf("no build found for version %s and device %s", version, identifier)
+
+	best := slices.MaxFunc(builds, func(a, b *build) int {
+		if n := cmp.Compare(a.devices, b.devices); n != 0 {
+			return n
+		}
+		if n := a.uploaded.Compare(b.uploaded); n != 0 {
+			return n
+		}
+		return cmp.Compare(a.id, b.id)
+	})
+
+	return best.id, nil
+}
+
+// ResolveIPSW returns the best IPSW of a version for a device using the DefaultClient
+func ResolveIPSW(identifier, version string) (IPSW, error) {
+	return DefaultClient().ResolveIPSW(identifier, version)
+}
+
+// ResolveIPSW returns the best IPSW of a version for a device
+//
+// When a version was respun (several builds) the signed build is preferred, falling back to the
+// most recently released build when none of them are signed.
+func (c *Client) ResolveIPSW(identifier, version string) (IPSW, error) {
+	d, err := c.GetDevice(identifier)
+	if err != nil {
+		return IPSW{}, err
+	}
+
+	var best IPSW
+	found := false
+	for _, i := range d.Firmwares {
+		if i.Version != version {
+			continue
+		}
+		if !found || (i.Signed && !best.Signed) || (i.Signed == best.Signed && i.ReleaseDate.After(best.ReleaseDate)) {
+			best = i
+			found = true
+		}
+	}
+	if !found {
+		return IPSW{}, fmt.Errorf("%w for version %s and device %s", ErrBuildNotFound, version, d.Identifier)
+	}
+
+	return best, nil
 }
 
 // GetSE2ToSE3Mapping returns the device mapping between SE2 and SE3
@@ -248,49 +696,157 @@ func GetSE2ToSE3Mapping() DeviceMapping {
 
 // GetCompatibleIPSWs returns IPSWs that are compatible between SE2 and SE3
 func GetCompatibleIPSWs(version string) ([]IPSW, error) {
+	return DefaultClient().GetCompatibleIPSWs(version)
+}
+
+// GetCompatibleIPSWs returns IPSWs that are compatible between SE2 and SE3
+//
+// Only the SE3 side is returned, use GetCompatiblePairs to also get the matching SE2 IPSWs.
+func (c *Client) GetCompatibleIPSWs(version string) ([]IPSW, error) {
+	return CompatibleIPSWs(c, version)
+}
+
+// CompatibleIPSWs is GetCompatibleIPSWs on top of any API, e.g. a downloadtest.FakeAPI in tests
+func CompatibleIPSWs(api API, version string) ([]IPSW, error) {
 	compatibleIPSWs := []IPSW{}
-	
-	// Get SE2 IPSWs
-	se2IPSWs, err := GetDeviceIPSWs(iPhoneSE2Identifier)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get SE2 IPSWs: %v", err)
-	}
-	
-	// Get SE3 IPSWs  
-	se3IPSWs, err := GetDeviceIPSWs(iPhoneSE3Identifier)
+
+	se2IPSWs, se3IPSWs, err := se2AndSE3IPSWs(api)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get SE3 IPSWs: %v", err)
+		return nil, err
 	}
-	
+
 	// Find compatible versions (same iOS version)
 	versionMap := make(map[string]bool)
 	for _, ipsw := range se2IPSWs {
 		versionMap[ipsw.Version] = true
 	}
-	
+
 	for _, ipsw := range se3IPSWs {
 		if versionMap[ipsw.Version] {
 			compatibleIPSWs = append(compatibleIPSWs, ipsw)
 		}
 	}
-	
+
 	return compatibleIPSWs, nil
 }
 
+// se2AndSE3IPSWs returns the IPSWs of the SE2 and of the SE3
+func se2AndSE3IPSWs(api API) (se2, se3 []IPSW, err error) {
+	se2, err = api.GetDeviceIPSWs(iPhoneSE2Identifier)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get SE2 IPSWs: %w", err)
+	}
+	se3, err = api.GetDeviceIPSWs(iPhoneSE3Identifier)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get SE3 IPSWs: %w", err)
+	}
+	return se2, se3, nil
+}
+
+// CompatiblePair is the SE2 and SE3 IPSWs of a version both devices have firmwares for
+type CompatiblePair struct {
+	Version string
+	SE2     IPSW
+	SE3     IPSW
+}
+
+// GetCompatiblePairs returns the SE2/SE3 IPSW pairs of every common version using the DefaultClient
+func GetCompatiblePairs() ([]CompatiblePair, error) {
+	return DefaultClient().GetCompatiblePairs()
+}
+
+// GetCompatiblePairs returns the SE2 and SE3 IPSWs of every version both devices have firmwares for
+// sorted by version, when a version has several builds for a device its newest one is used
+func (c *Client) GetCompatiblePairs() ([]CompatiblePair, error) {
+	return CompatiblePairs(c)
+}
+
+// CompatiblePairs is GetCompatiblePairs on top of any API, e.g. a downloadtest.FakeAPI in tests
+func CompatiblePairs(api API) ([]CompatiblePair, error) {
+	se2IPSWs, se3IPSWs, err := se2AndSE3IPSWs(api)
+	if err != nil {
+		return nil, err
+	}
+
+	newest := func(ipsws []IPSW) map[string]IPSW {
+		byVersion := make(map[string]IPSW)
+		for _, i := range ipsws {
+			if prev, ok := byVersion[i.Version]; !ok || i.ReleaseDate.After(prev.ReleaseDate) {
+				byVersion[i.Version] = i
+			}
+		}
+		return byVersion
+	}
+	se2 := newest(se2IPSWs)
+	se3 := newest(se3IPSWs)
+
+	pairs := []CompatiblePair{}
+	for version, i := range se2 {
+		if j, ok := se3[version]; ok {
+			pairs = append(pairs, CompatiblePair{Version: version, SE2: i, SE3: j})
+		}
+	}
+	slices.SortFunc(pairs, func(a, b CompatiblePair) int {
+		va, errA := ParseVersion(a.Version)
+		vb, errB := ParseVersion(b.Version)
+		switch {
+		case errA != nil || errB != nil:
+			return strings.Compare(a.Version, b.Version)
+		case va.Less(vb):
+			return -1
+		case vb.Less(va):
+			return 1
+		default:
+			return strings.Compare(a.Version, b.Version)
+		}
+	})
+
+	return pairs, nil
+}
+
 // GetSE3IPSWForSE2Version finds the SE3 IPSW that matches an SE2 iOS version
 func GetSE3IPSWForSE2Version(se2Version string) (IPSW, error) {
-	se3IPSWs, err := GetDeviceIPSWs(iPhoneSE3Identifier)
+	return DefaultClient().GetSE3IPSWForSE2Version(se2Version)
+}
+
+// GetSE3IPSWForSE2Version finds the SE3 IPSW that matches an SE2 iOS version, see GetEquivalentIPSW
+func (c *Client) GetSE3IPSWForSE2Version(se2Version string) (IPSW, error) {
+	return EquivalentIPSW(c, iPhoneSE2Identifier, iPhoneSE3Identifier, se2Version)
+}
+
+// GetEquivalentIPSW finds the IPSW of the target device matching a version of the source device using the DefaultClient
+func GetEquivalentIPSW(sourceID, targetID, sourceVersion string) (IPSW, error) {
+	return DefaultClient().GetEquivalentIPSW(sourceID, targetID, sourceVersion)
+}
+
+// GetEquivalentIPSW finds the IPSW of the target device matching a version of the source device
+// (e.g. a pair of DefaultDeviceMap)
+//
+// An exact version match is preferred, otherwise versions are compared with CompareVersions
+// so 16.3 matches 16.3.0.
+func (c *Client) GetEquivalentIPSW(sourceID, targetID, sourceVersion string) (IPSW, error) {
+	return EquivalentIPSW(c, sourceID, targetID, sourceVersion)
+}
+
+// EquivalentIPSW is GetEquivalentIPSW on top of any API, e.g. a downloadtest.FakeAPI in tests
+func EquivalentIPSW(api API, sourceID, targetID, sourceVersion string) (IPSW, error) {
+	ipsws, err := api.GetDeviceIPSWs(targetID)
 	if err != nil {
-		return IPSW{}, fmt.Errorf("failed to get SE3 IPSWs: %v", err)
+		return IPSW{}, fmt.Errorf("failed to get %s IPSWs: %v", targetID, err)
 	}
-	
-	for _, ipsw := range se3IPSWs {
-		if ipsw.Version == se2Version {
+
+	for _, ipsw := range ipsws {
+		if ipsw.Version == sourceVersion {
 			return ipsw, nil
 		}
 	}
-	
-	return IPSW{}, fmt.Errorf("no SE3 IPSW found for SE2 version %s", se2Version)
+	for _, ipsw := range ipsws {
+		if CompareVersions(ipsw.Version, sourceVersion) == 0 {
+			return ipsw, nil
+		}
+	}
+
+	return IPSW{}, fmt.Errorf("%w: no %s IPSW for %s version %s", ErrBuildNotFound, targetID, sourceID, sourceVersion)
 }
 
 // IsSE2Device checks if the identifier is iPhone SE2
@@ -298,7 +854,7 @@ func IsSE2Device(identifier string) bool {
 	return identifier == iPhoneSE2Identifier
 }
 
-// IsSE3Device checks if the identifier is iPhone SE3  
+// IsSE3Device checks if the identifier is iPhone SE3
 func IsSE3Device(identifier string) bool {
 	return identifier == iPhoneSE3Identifier
 }
@@ -313,38 +869,353 @@ func ConvertSE2ToSE3Identifier(identifier string) string {
 
 // Release struct for releases endpoint
 type Release struct {
-	Version    string    `json:"version"`
-	BuildID    string    `json:"buildid"`
-	Released   time.Time `json:"released"`
-	Beta       bool      `json:"beta"`
-	RC         bool      `json:"rc"`
-	Signed     bool      `json:"signed"`
-	DeviceIDs  []string  `json:"deviceIds"`
+	Version   string    `json:"version"`
+	BuildID   string    `json:"buildid"`
+	Released  time.Time `json:"released"`
+	Beta      bool      `json:"beta"`
+	RC        bool      `json:"rc"`
+	Signed    bool      `json:"signed"`
+	DeviceIDs []string  `json:"deviceIds"`
+}
+
+// GetReleases returns all iOS releases
+func GetReleases(opts ...ClientOption) ([]Release, error) {
+	return DefaultClient().GetReleases(opts...)
 }
 
 // GetReleases returns all iOS releases
-func GetReleases() ([]Release, error) {
+func (c *Client) GetReleases(opts ...ClientOption) ([]Release, error) {
+	c = c.with(opts)
+	return c.getReleases(context.Background())
+}
+
+func (c *Client) getReleases(ctx context.Context) ([]Release, error) {
 	releases := []Release{}
 
-	res, err := http.Get(ipswMeAPI + "releases")
-	if err != nil {
+	if err := c.getJSON(ctx, "releases", &releases); err != nil {
 		return releases, err
 	}
+
+	return releases, nil
+}
+
+// IsBuildSigned returns whether a build is currently signed for a given device
+func IsBuildSigned(identifier, buildID string) (bool, error) {
+	return DefaultClient().IsBuildSigned(identifier, buildID)
+}
+
+// IsBuildSigned returns whether a build is currently signed for a given device
+func (c *Client) IsBuildSigned(identifier, buildID string) (bool, error) {
+	return c.GetSigningStatus(identifier, buildID)
+}
+
+// GetSigningStatus returns whether a build is currently signed for a given device
+func GetSigningStatus(identifier, buildID string) (bool, error) {
+	return DefaultClient().GetSigningStatus(identifier, buildID)
+}
+
+// GetSigningStatus returns whether a build is currently signed for a given device
+func (c *Client) GetSigningStatus(identifier, buildID string) (bool, error) {
+	i, err := c.GetIPSW(identifier, buildID)
+	if err != nil {
+		return false, err
+	}
+	return i.Signed, nil
+}
+
+// GetIPSWsForBuild returns every device's IPSW for a given build ID
+func GetIPSWsForBuild(buildID string) ([]IPSW, error) {
+	return DefaultClient().GetIPSWsForBuild(buildID)
+}
+
+// GetIPSWsForBuild returns every device's IPSW for a given build ID
+//
+// The version is resolved from the build ID first and the version's IPSWs are then
+// filtered to the exact build, as some devices can ship the same version with a different build.
+func (c *Client) GetIPSWsForBuild(buildID string) ([]IPSW, error) {
+	version, err := c.GetVersion(buildID)
+	if err != nil {
+		return nil, err
+	}
+
+	ipsws, err := c.GetAllIPSW(version)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []IPSW{}
+	for _, i := range ipsws {
+		if i.BuildID == buildID {
+			matches = append(matches, i)
+		}
+	}
+
+	return matches, nil
+}
+
+// GetVersionFast returns the iOS version for a given build ID using only the releases feed
+func GetVersionFast(buildID string) (string, error) {
+	return DefaultClient().GetVersionFast(buildID)
+}
+
+// GetVersionFast returns the iOS version for a given build ID using only the releases feed
+//
+// Unlike GetVersion it makes a single request and never falls back to scanning every device,
+// so it may miss builds that are absent from the /releases feed.
+func (c *Client) GetVersionFast(buildID string) (string, error) {
+	releases, err := c.GetReleases()
+	if err != nil {
+		return "", fmt.Errorf("failed to get releases from ipsw.me API: %v", err)
+	}
+
+	for _, r := range releases {
+		if r.BuildID == buildID {
+			return r.Version, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w for build %s in the ipsw.me releases feed", ErrVersionNotFound, buildID)
+}
+
+// maxContentSnippet is the number of body bytes included in ErrUnexpectedContent errors
+const maxContentSnippet = 128
+
+// checkContent fails with ErrUnexpectedContent when an API response is not JSON
+// (e.g. an HTML outage page served with a 200 status)
+func checkContent(res *http.Response, body []byte) error {
+	trimmed := bytes.TrimSpace(body)
+	ct := res.Header.Get("Content-Type")
+	if bytes.HasPrefix(trimmed, []byte("<")) || (ct != "" && !strings.Contains(ct, "json")) {
+		snippet := trimmed[:min(len(trimmed), maxContentSnippet)]
+		return fmt.Errorf("%w (content-type %q): %s", ErrUnexpectedContent, ct, snippet)
+	}
+	return nil
+}
+
+// getJSON decodes the JSON response of the API endpoint at path (relative to the base URL) into out
+//
+// All API requests go through it (and fetch) so headers, status and content checks and caching
+// are handled in one place. Without a cache the response is decoded as it is read instead of
+// being buffered, which matters for the large devices and releases payloads.
+func (c *Client) getJSON(ctx context.Context, path string, out any) error {
+	if c.cache == nil {
+		return c.retry(ctx, func() error {
+			return c.decodeAttempt(ctx, path, out)
+		})
+	}
+
+	body, err := c.fetch(ctx, path)
+	if err != nil {
+		return err
+	}
+	if err := checkEmpty(path, body); err != nil {
+		return err
+	}
+	if err := checkShape(path, body, out); err != nil {
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
+
+// decodeAttempt makes a single request for path streaming the response into out
+func (c *Client) decodeAttempt(ctx context.Context, path string, out any) error {
+	url := c.baseURL + path
+	res, err := c.do(ctx, path, nil)
+	if err != nil {
+		return &NetworkError{Err: err}
+	}
 	defer res.Body.Close()
-	
+
 	if res.StatusCode != http.StatusOK {
-		return releases, fmt.Errorf("api returned status: %s", res.Status)
+		// drain the error page so the connection can be reused by the next attempt
+		io.Copy(io.Discard, io.LimitReader(res.Body, maxDrainBytes))
+		return &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+	}
+
+	body := bufio.NewReader(c.limitBody(url, res.Body))
+	// the content and shape checks only need the start of the body
+	head, err := body.Peek(maxContentSnippet)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return err
+	}
+	if err := checkContent(res, head); err != nil {
+		return err
+	}
+	if err := checkEmpty(path, head); err != nil {
+		return err
+	}
+	if err := checkShape(path, head, out); err != nil {
+		return err
+	}
+
+	if err := json.NewDecoder(body).Decode(out); err == io.EOF {
+		return fmt.Errorf("%w: %s", ErrEmptyResponse, path)
+	} else if err != nil {
+		return err
+	}
+	// read up to EOF so the connection can be reused
+	_, err = io.Copy(io.Discard, body)
+	return err
+}
+
+// checkEmpty fails with ErrEmptyResponse when body is empty, whitespace or null, which the API
+// answers with a 200 status during incidents and would otherwise decode to a zero value
+func checkEmpty(path string, body []byte) error {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return fmt.Errorf("%w: %s", ErrEmptyResponse, path)
+	}
+	return nil
+}
+
+// checkShape fails with ErrUnexpectedShape when body is a JSON array but out expects an object or vice versa
+// (e.g. a mirror or error page answering with the wrong document), instead of an obscure unmarshal error
+func checkShape(path string, body []byte, out any) error {
+	var want byte
+	switch reflect.TypeOf(out).Elem().Kind() {
+	case reflect.Slice, reflect.Array:
+		want = '['
+	case reflect.Struct, reflect.Map:
+		want = '{'
+	default:
+		return nil
 	}
 
-	body, err := io.ReadAll(res.Body)
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] == want || bytes.Equal(trimmed, []byte("null")) {
+		return nil
+	}
+
+	shape := func(b byte) string {
+		switch b {
+		case '[':
+			return "array"
+		case '{':
+			return "object"
+		default:
+			return "value"
+		}
+	}
+	snippet := trimmed[:min(len(trimmed), maxContentSnippet)]
+	return fmt.Errorf("%w: %s returned a JSON %s, expected an %s: %s", ErrUnexpectedShape, path, shape(trimmed[0]), shape(want), snippet)
+}
+
+// fetch returns the body of a successful GET request for path, served from the cache when enabled
+// and retried as configured with WithRetry
+func (c *Client) fetch(ctx context.Context, path string) ([]byte, error) {
+	url := c.baseURL + path
+	if body, ok := c.cache.get(url); ok {
+		return body, nil
+	}
+
+	var body []byte
+	err := c.retry(ctx, func() (err error) {
+		body, err = c.fetchAttempt(ctx, path)
+		return err
+	})
 	if err != nil {
-		return releases, err
+		return nil, err
+	}
+
+	c.cache.set(url, body)
+
+	return body, nil
+}
+
+// retry calls attempt until it succeeds or fails with an error the RetryPolicy doesn't retry,
+// at most the number of attempts set with WithRetry
+func (c *Client) retry(ctx context.Context, attempt func() error) error {
+	var err error
+	for n := 0; n < max(c.retryAttempts, 1); n++ {
+		if n > 0 {
+			delay := c.retryDelay << (n - 1)
+			// wait between half and all of the delay so clients failing together don't retry together
+			delay = delay/2 + time.Duration(rand.Int64N(int64(delay/2)+1))
+			c.logger.WithError(err).Debugf("request attempt %d failed, retrying in %s", n, delay)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		err = attempt()
+		if err == nil || ctx.Err() != nil || !c.shouldRetry(err) {
+			break
+		}
 	}
+	return err
+}
 
-	err = json.Unmarshal(body, &releases)
+// fetchAttempt makes a single request for path
+func (c *Client) fetchAttempt(ctx context.Context, path string) ([]byte, error) {
+	res, err := c.do(ctx, path, nil)
 	if err != nil {
-		return releases, err
+		return nil, &NetworkError{Err: err}
 	}
+	defer res.Body.Close()
 
-	return releases, nil
+	if res.StatusCode != http.StatusOK {
+		// drain the error page so the connection can be reused by the next attempt
+		io.Copy(io.Discard, io.LimitReader(res.Body, maxDrainBytes))
+		return nil, &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+	}
+
+	return c.readBody(c.baseURL+path, res)
+}
+
+// limitBody returns r failing with ErrResponseTooLarge once more than WithMaxResponseBytes are read
+func (c *Client) limitBody(url string, r io.Reader) io.Reader {
+	if c.maxResponseBytes <= 0 {
+		return r
+	}
+	return &limitReader{r: r, url: url, limit: c.maxResponseBytes}
+}
+
+// limitReader reads up to limit bytes from r and then fails with ErrResponseTooLarge
+// if r has more
+type limitReader struct {
+	r     io.Reader
+	url   string
+	limit int64
+	n     int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n > l.limit {
+		return 0, l.err()
+	}
+	// read at most one byte past the limit to detect a larger body
+	if room := l.limit - l.n + 1; int64(len(p)) > room {
+		p = p[:room]
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.limit {
+		return n - int(l.n-l.limit), l.err()
+	}
+	return n, err
+}
+
+func (l *limitReader) err() error {
+	return fmt.Errorf("%w: %s is larger than %d bytes", ErrResponseTooLarge, l.url, l.limit)
+}
+
+// maxDrainBytes is the most read from an error response to reuse its connection,
+// larger bodies are dropped with the connection
+const maxDrainBytes = 64 << 10
+
+// readBody reads the body of a successful API response for url enforcing WithMaxResponseBytes
+// and checking it is JSON
+func (c *Client) readBody(url string, res *http.Response) ([]byte, error) {
+	body, err := io.ReadAll(c.limitBody(url, res.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkContent(res, body); err != nil {
+		return nil, err
+	}
+
+	return body, nil
 }
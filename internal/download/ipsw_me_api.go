@@ -0,0 +1,18 @@
+package download
+
+// API is the ipsw.me lookups a Client provides, depend on it instead of *Client or the
+// package-level functions to be able to inject a fake (see downloadtest.FakeAPI) in tests
+type API interface {
+	GetAllDevices(opts ...ClientOption) ([]Device, error)
+	GetDevice(identifier string, opts ...ClientOption) (Device, error)
+	GetDeviceIPSWs(identifier string, opts ...ClientOption) ([]IPSW, error)
+	GetAllIPSW(version string, opts ...ClientOption) ([]IPSW, error)
+	GetIPSW(identifier, buildID string, opts ...ClientOption) (IPSW, error)
+	GetVersion(buildID string, opts ...ClientOption) (string, error)
+	GetBuildID(version, identifier string, opts ...ClientOption) (string, error)
+	GetReleases(opts ...ClientOption) ([]Release, error)
+	GetDeviceOTAs(identifier string, opts ...ClientOption) ([]OTA, error)
+	IsBuildSigned(identifier, buildID string) (bool, error)
+}
+
+var _ API = (*Client)(nil)
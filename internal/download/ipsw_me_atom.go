@@ -0,0 +1,101 @@
+package download
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+)
+
+const atomNS = "http://www.w3.org/2005/Atom"
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	NS      string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID        string       `xml:"id"`
+	Title     string       `xml:"title"`
+	Updated   string       `xml:"updated"`
+	Published string       `xml:"published"`
+	Category  atomCategory `xml:"category"`
+	Summary   string       `xml:"summary,omitempty"`
+}
+
+// WriteReleasesAtom writes the releases to w as an Atom feed with one entry per release
+// titled "<version> (<build>)", published at its release date and categorized by channel (ga, beta or rc)
+func WriteReleasesAtom(w io.Writer, releases []Release) error {
+	feed := atomFeed{
+		NS:     atomNS,
+		ID:     ipswMeAPI + "releases",
+		Title:  "ipsw.me releases",
+		Author: atomAuthor{Name: "ipsw.me"},
+		Link:   atomLink{Href: ipswMeAPI + "releases", Rel: "alternate"},
+	}
+
+	var updated time.Time
+	for _, r := range releases {
+		if r.Released.After(updated) {
+			updated = r.Released
+		}
+		title := r.Version
+		if r.BuildID != "" {
+			title += " (" + r.BuildID + ")"
+		}
+		entry := atomEntry{
+			ID:        ipswMeAPI + "releases#" + url.PathEscape(r.Version+"-"+r.BuildID),
+			Title:     title,
+			Updated:   atomTime(r.Released),
+			Published: atomTime(r.Released),
+			Category:  atomCategory{Term: r.Type().String()},
+		}
+		if len(r.DeviceIDs) > 0 {
+			entry.Summary = fmt.Sprintf("Released for %d devices", len(r.DeviceIDs))
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	feed.Updated = atomTime(updated)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return fmt.Errorf("failed to encode atom feed: %v", err)
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// atomTime formats t as an RFC 3339 date, the zero time is the Unix epoch as Atom dates are mandatory
+func atomTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Unix(0, 0)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,180 @@
+package download
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blacktop/ranger"
+)
+
+// buildManifestName is the path of the build manifest inside an IPSW
+const buildManifestName = "BuildManifest.plist"
+
+// DownloadBuildManifest downloads the BuildManifest.plist of an IPSW to dest using the DefaultClient
+func DownloadBuildManifest(ctx context.Context, i IPSW, dest string) error {
+	return DefaultClient().DownloadBuildManifest(ctx, i, dest)
+}
+
+// DownloadBuildManifest downloads only the BuildManifest.plist of an IPSW to dest
+//
+// The IPSW zip's central directory and the manifest are read with HTTP range requests so only a few
+// hundred KB are transferred. If the server doesn't support range requests the whole IPSW is downloaded
+// to a temporary file (in the WithTempDir directory if set) which is removed once the manifest is extracted,
+// any other failure (e.g. a 404 or a network error) is returned as is.
+func (c *Client) DownloadBuildManifest(ctx context.Context, i IPSW, dest string) error {
+	if i.URL == "" {
+		return fmt.Errorf("%w: %s", ErrNotDownloadable, i)
+	}
+
+	zr, err := c.remoteZip(ctx, i.URL)
+	if errors.Is(err, errRangesUnsupported) {
+		c.logger.WithError(err).Warn("failed to read IPSW remotely, downloading all of it")
+		return c.downloadBuildManifestFull(ctx, i, dest)
+	} else if err != nil {
+		return err
+	}
+
+	return extractZipFile(zr, buildManifestName, dest)
+}
+
+// errRangesUnsupported is returned by remoteZip when the server can't serve the zip with range requests
+var errRangesUnsupported = errors.New("server doesn't support range requests")
+
+// probeRanges checks that the server at zipURL answers range requests with a validator
+// (needed by ranger to detect the file changing between reads), returning errRangesUnsupported if not
+func (c *Client) probeRanges(ctx context.Context, zipURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, zipURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create http GET request: %v", err)
+	}
+	c.setHeaders(req)
+	req.Header.Set("Range", "bytes=0-0")
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return &NetworkError{Err: err}
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, maxDrainBytes))
+
+	switch {
+	case res.StatusCode == http.StatusOK:
+		return fmt.Errorf("%w: %s ignored the range request", errRangesUnsupported, zipURL)
+	case res.StatusCode != http.StatusPartialContent:
+		return &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+	case !strings.HasPrefix(res.Header.Get("ETag"), `"`) && res.Header.Get("Last-Modified") == "":
+		return fmt.Errorf("%w: %s has no ETag or Last-Modified validator", errRangesUnsupported, zipURL)
+	}
+	return nil
+}
+
+// remoteZip opens the zip at zipURL reading it with HTTP range requests made with the client's http.Client
+func (c *Client) remoteZip(ctx context.Context, zipURL string) (*zip.Reader, error) {
+	u, err := url.Parse(zipURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse url: %v", err)
+	}
+	if err := c.probeRanges(ctx, zipURL); err != nil {
+		return nil, err
+	}
+
+	hc := *c.httpClient
+	hc.Transport = ctxTransport{ctx: ctx, base: hc.Transport}
+	reader, err := ranger.NewReader(&ranger.HTTPRanger{
+		URL:       u,
+		UserAgent: c.userAgentHeader(),
+		Client:    &hc,
+		// probeRanges already checked the server honors ranges, some don't advertise it on HEAD
+		DisableAcceptRangesHeaderCheck: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ranger reader: %v", err)
+	}
+
+	length, err := reader.Length()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reader length: %v", err)
+	}
+
+	zr, err := zip.NewReader(reader, length)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zip reader: %v", err)
+	}
+
+	return zr, nil
+}
+
+// downloadBuildManifestFull downloads the whole IPSW to extract its build manifest
+func (c *Client) downloadBuildManifestFull(ctx context.Context, i IPSW, dest string) error {
+	if !i.IsDownloadable() {
+		return fmt.Errorf("%w: %s", ErrNotDownloadable, i)
+	}
+
+	tmp, err := os.MkdirTemp(c.tempDir, "ipsw-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, filepath.Base(dest)+".ipsw")
+	defer lockDest(path)()
+	if err := c.download(ctx, i.URL, i.FileSize, checksums{sha1: i.SHA1, md5: i.MD5}, path); err != nil {
+		return err
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer zr.Close()
+
+	return extractZipFile(&zr.Reader, buildManifestName, dest)
+}
+
+// extractZipFile extracts the file name from zr to dest, writing it to dest.part first so dest is never left incomplete
+func extractZipFile(zr *zip.Reader, name, dest string) error {
+	rc, err := zr.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to find %s: %v", name, err)
+	}
+	defer rc.Close()
+
+	part := dest + ".part"
+	f, err := os.Create(part)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", part, err)
+	}
+	if _, err := io.Copy(f, rc); err != nil {
+		f.Close()
+		os.Remove(part)
+		return fmt.Errorf("failed to extract %s: %v", name, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(part)
+		return fmt.Errorf("failed to close %s: %v", part, err)
+	}
+
+	return os.Rename(part, dest)
+}
+
+// ctxTransport binds requests made by code that doesn't take a context (e.g. ranger) to ctx
+type ctxTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t ctxTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req.WithContext(t.ctx))
+}
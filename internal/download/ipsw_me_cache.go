@@ -0,0 +1,68 @@
+package download
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	body    []byte
+	expires time.Time
+}
+
+// responseCache is an in-memory cache of API response bodies keyed by URL
+type responseCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	jitter  float64
+	now     func() time.Time
+	entries map[string]cacheEntry
+}
+
+func newResponseCache(ttl time.Duration, jitter float64, now func() time.Time) *responseCache {
+	return &responseCache{
+		ttl:     ttl,
+		jitter:  jitter,
+		now:     now,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// get returns the cached body for url, a nil cache never has any entries
+func (rc *responseCache) get(url string) ([]byte, bool) {
+	if rc == nil {
+		return nil, false
+	}
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	e, ok := rc.entries[url]
+	if !ok || rc.now().After(e.expires) {
+		return nil, false
+	}
+	return e.body, true
+}
+
+func (rc *responseCache) set(url string, body []byte) {
+	if rc == nil {
+		return
+	}
+	// shorten each entry's TTL by a random fraction so entries cached at the same time don't all expire together
+	ttl := rc.ttl
+	if rc.jitter > 0 {
+		ttl -= time.Duration(rand.Float64() * rc.jitter * float64(ttl))
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.entries[url] = cacheEntry{body: body, expires: rc.now().Add(ttl)}
+}
+
+// clear drops every entry
+func (rc *responseCache) clear() {
+	if rc == nil {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	clear(rc.entries)
+}
@@ -0,0 +1,374 @@
+package download
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// catalogConcurrency is the number of concurrent per-device requests made when hydrating firmwares
+const catalogConcurrency = 8
+
+// GetDevicesFromCatalog returns the devices for the given identifiers using the DefaultClient
+func GetDevicesFromCatalog(identifiers []string, hydrateFirmwares bool) (map[string]Device, error) {
+	return DefaultClient().GetDevicesFromCatalog(identifiers, hydrateFirmwares)
+}
+
+// GetDevicesFromCatalog returns the devices for the given identifiers keyed by identifier
+//
+// The full device catalog is fetched once and filtered locally, which is far cheaper than
+// calling GetDevice for each identifier. The catalog endpoint does NOT include firmwares
+// so Device.Firmwares is empty unless hydrateFirmwares is set, in which case each matched
+// device is fetched concurrently (see WithMaxConcurrency) to fill them in.
+//
+// The identifiers are normalized with NormalizeIdentifier and the map is keyed by the canonical
+// identifier. Identifiers not in the catalog are omitted.
+func (c *Client) GetDevicesFromCatalog(identifiers []string, hydrateFirmwares bool) (map[string]Device, error) {
+	devices, err := c.GetAllDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(identifiers))
+	for _, id := range identifiers {
+		wanted[NormalizeIdentifier(id)] = true
+	}
+
+	found := make(map[string]Device, len(identifiers))
+	for _, d := range devices {
+		if wanted[d.Identifier] {
+			found[d.Identifier] = d
+		}
+	}
+
+	if !hydrateFirmwares {
+		return found, nil
+	}
+
+	hydrated := make([]Device, 0, len(found))
+	for _, d := range found {
+		hydrated = append(hydrated, d)
+	}
+	if err := c.HydrateFirmwares(context.Background(), hydrated, c.maxConcurrency); err != nil {
+		return nil, err
+	}
+	for _, d := range hydrated {
+		found[d.Identifier] = d
+	}
+
+	return found, nil
+}
+
+// HydrateFirmwares fills in the Firmwares of the devices in place using the DefaultClient
+func HydrateFirmwares(ctx context.Context, devices []Device, concurrency int) error {
+	return DefaultClient().HydrateFirmwares(ctx, devices, concurrency)
+}
+
+// HydrateFirmwares fills in the Firmwares of the devices in place by fetching each device
+// with at most concurrency requests in flight
+//
+// A failure for one device doesn't abort the others, all per-device errors are joined into the
+// returned error. Devices that were not hydrated (failed or cancelled) are left untouched.
+func (c *Client) HydrateFirmwares(ctx context.Context, devices []Device, concurrency int) error {
+	var mu sync.Mutex
+	var errs []error
+
+	var g errgroup.Group
+	g.SetLimit(max(concurrency, 1))
+	for idx := range devices {
+		if ctx.Err() != nil {
+			break
+		}
+		g.Go(func() error {
+			dev, err := c.getDevice(ctx, devices[idx].Identifier)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("failed to get %s firmwares: %w", devices[idx].Identifier, err))
+				mu.Unlock()
+				return nil
+			}
+			devices[idx].Firmwares = dev.Firmwares
+			return nil
+		})
+	}
+	g.Wait()
+
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// GetFullCatalog returns every device with its firmwares using the DefaultClient
+func GetFullCatalog(ctx context.Context, concurrency int) ([]Device, error) {
+	return DefaultClient().GetFullCatalog(ctx, concurrency)
+}
+
+// GetFullCatalog returns every device with its firmwares populated by fetching the device list
+// and then hydrating each device with at most concurrency requests in flight
+//
+// On partial failure the devices are returned along with the joined per-device errors,
+// devices that could not be hydrated have no Firmwares.
+func (c *Client) GetFullCatalog(ctx context.Context, concurrency int) ([]Device, error) {
+	devices, err := c.getAllDevices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device list: %w", err)
+	}
+	return devices, c.HydrateFirmwares(ctx, devices, concurrency)
+}
+
+// DedupeDevices collapses devices with the same identifier into a single entry, preferring the entry
+// with a non-empty Name and BoardConfig (the first one if they are equally complete), keeping the input order
+func DedupeDevices(devices []Device) []Device {
+	deduped, _ := dedupeDevices(devices)
+	return deduped
+}
+
+// dedupeDevices is DedupeDevices also returning the identifiers that were duplicated
+func dedupeDevices(devices []Device) ([]Device, []string) {
+	completeness := func(d Device) int {
+		var n int
+		if d.Name != "" {
+			n++
+		}
+		if d.BoardConfig != "" {
+			n++
+		}
+		return n
+	}
+
+	deduped := make([]Device, 0, len(devices))
+	seen := make(map[string]int, len(devices))
+	var dups []string
+	for _, d := range devices {
+		idx, ok := seen[d.Identifier]
+		if !ok {
+			seen[d.Identifier] = len(deduped)
+			deduped = append(deduped, d)
+			continue
+		}
+		if !slices.Contains(dups, d.Identifier) {
+			dups = append(dups, d.Identifier)
+		}
+		if completeness(d) > completeness(deduped[idx]) {
+			deduped[idx] = d
+		}
+	}
+
+	return deduped, dups
+}
+
+// DiffDevices compares two catalog snapshots keyed by identifier
+//
+// It returns the devices only in new (added), the devices only in old (removed) and the
+// devices present in both whose Name changed (renamed, with their new entry), each sorted by identifier.
+func DiffDevices(old, new []Device) (added, removed, renamed []Device) {
+	before := make(map[string]Device, len(old))
+	for _, d := range old {
+		before[d.Identifier] = d
+	}
+	after := make(map[string]Device, len(new))
+	for _, d := range new {
+		after[d.Identifier] = d
+	}
+
+	for id, d := range after {
+		prev, ok := before[id]
+		switch {
+		case !ok:
+			added = append(added, d)
+		case prev.Name != d.Name:
+			renamed = append(renamed, d)
+		}
+	}
+	for id, d := range before {
+		if _, ok := after[id]; !ok {
+			removed = append(removed, d)
+		}
+	}
+
+	SortDevices(added, SortByIdentifier)
+	SortDevices(removed, SortByIdentifier)
+	SortDevices(renamed, SortByIdentifier)
+
+	return added, removed, renamed
+}
+
+// BuildIndex returns a build ID to version map using the DefaultClient
+func BuildIndex(ctx context.Context, scanFirmwares bool) (map[string]string, error) {
+	return DefaultClient().BuildIndex(ctx, scanFirmwares)
+}
+
+// BuildIndex returns a build ID to version map built from a single /releases request,
+// meant to be kept by callers resolving many build IDs instead of calling GetVersion for each
+//
+// Builds missing from the releases feed (e.g. some betas) are not in the index unless scanFirmwares
+// is set, in which case every device's firmwares are also fetched (see GetFullCatalog and WithMaxConcurrency)
+// to fill the gaps; a build listed by both keeps the version from /releases.
+// If some devices fail the index built from the rest is still returned, along with their joined errors.
+func (c *Client) BuildIndex(ctx context.Context, scanFirmwares bool) (map[string]string, error) {
+	releases, err := c.getReleases(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get releases from ipsw.me API: %w", err)
+	}
+
+	index := make(map[string]string, len(releases))
+	for _, r := range releases {
+		if r.BuildID != "" && r.Version != "" {
+			index[r.BuildID] = r.Version
+		}
+	}
+
+	if !scanFirmwares {
+		return index, nil
+	}
+
+	devices, err := c.GetFullCatalog(ctx, c.maxConcurrency)
+	for _, d := range devices {
+		for _, i := range d.Firmwares {
+			if _, ok := index[i.BuildID]; !ok && i.BuildID != "" && i.Version != "" {
+				index[i.BuildID] = i.Version
+			}
+		}
+	}
+
+	return index, err
+}
+
+// ResolveURLs fills in the missing URLs of IPSWs using the DefaultClient
+func ResolveURLs(ctx context.Context, ipsws []IPSW, concurrency int) ([]IPSW, error) {
+	return DefaultClient().ResolveURLs(ctx, ipsws, concurrency)
+}
+
+// ResolveURLs returns a copy of ipsws with the empty URLs filled in by looking up each of those
+// IPSWs by identifier and build ID, with at most concurrency requests in flight
+//
+// Entries that already have a URL are untouched. A failure for one entry doesn't abort the others,
+// those entries keep their empty URL and all per-entry errors are joined into the returned error.
+func (c *Client) ResolveURLs(ctx context.Context, ipsws []IPSW, concurrency int) ([]IPSW, error) {
+	resolved := slices.Clone(ipsws)
+
+	var mu sync.Mutex
+	var errs []error
+
+	var g errgroup.Group
+	g.SetLimit(max(concurrency, 1))
+	for idx := range resolved {
+		if resolved[idx].URL != "" {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		g.Go(func() error {
+			i, err := c.getIPSW(ctx, resolved[idx].Identifier, resolved[idx].BuildID)
+			if err == nil && i.URL == "" {
+				err = fmt.Errorf("no URL returned")
+			}
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("failed to resolve %s URL: %w", resolved[idx], err))
+				mu.Unlock()
+				return nil
+			}
+			resolved[idx].URL = i.URL
+			return nil
+		})
+	}
+	g.Wait()
+
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return resolved, errors.Join(errs...)
+}
+
+// GetAllIPSWForVersions returns the IPSWs of each version using the DefaultClient
+func GetAllIPSWForVersions(ctx context.Context, versions []string, concurrency int) (map[string][]IPSW, error) {
+	return DefaultClient().GetAllIPSWForVersions(ctx, versions, concurrency)
+}
+
+// GetAllIPSWForVersions returns the IPSWs of each version keyed by version, fetching the versions
+// with at most concurrency requests in flight
+//
+// A failure for one version doesn't abort the others, failed versions are missing from the map
+// and all per-version errors are joined into the returned error.
+func (c *Client) GetAllIPSWForVersions(ctx context.Context, versions []string, concurrency int) (map[string][]IPSW, error) {
+	var mu sync.Mutex
+	var errs []error
+	ipsws := make(map[string][]IPSW, len(versions))
+
+	var g errgroup.Group
+	g.SetLimit(max(concurrency, 1))
+	for _, version := range versions {
+		if ctx.Err() != nil {
+			break
+		}
+		g.Go(func() error {
+			is, err := c.getAllIPSW(ctx, version)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to get %s IPSWs: %w", version, err))
+				return nil
+			}
+			ipsws[version] = is
+			return nil
+		})
+	}
+	g.Wait()
+
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return ipsws, errors.Join(errs...)
+}
+
+// GetDeviceComplete returns a device merged with its catalog entry using the DefaultClient
+func GetDeviceComplete(ctx context.Context, identifier string) (Device, error) {
+	return DefaultClient().GetDeviceComplete(ctx, identifier)
+}
+
+// GetDeviceComplete returns a device with its firmwares (from /device/<id>) merged with its
+// catalog entry (from /devices, served from the cache when WithCache is used)
+//
+// Fields missing from the device are filled in from the catalog and the boards of both
+// are combined without duplicates. A device missing from the catalog is returned as is.
+func (c *Client) GetDeviceComplete(ctx context.Context, identifier string) (Device, error) {
+	d, err := c.getDevice(ctx, identifier)
+	if err != nil {
+		return d, err
+	}
+	devices, err := c.getAllDevices(ctx)
+	if err != nil {
+		return d, fmt.Errorf("failed to get device list: %w", err)
+	}
+
+	idx := slices.IndexFunc(devices, func(cd Device) bool { return cd.Identifier == d.Identifier })
+	if idx < 0 {
+		return d, nil
+	}
+	cd := devices[idx]
+
+	d.Name = cmp.Or(d.Name, cd.Name)
+	d.BoardConfig = cmp.Or(d.BoardConfig, cd.BoardConfig)
+	d.Platform = cmp.Or(d.Platform, cd.Platform)
+	d.CpID = cmp.Or(d.CpID, cd.CpID)
+	d.BdID = cmp.Or(d.BdID, cd.BdID)
+	for _, b := range cd.Boards {
+		if !slices.ContainsFunc(d.Boards, func(db Board) bool { return strings.EqualFold(db.BoardConfig, b.BoardConfig) }) {
+			d.Boards = append(d.Boards, b)
+		}
+	}
+
+	return d, nil
+}
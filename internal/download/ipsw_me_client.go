@@ -0,0 +1,504 @@
+package download
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/apex/log"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+// Client is an ipsw.me API client
+type Client struct {
+	httpClient  *http.Client
+	baseURL     string
+	logger      log.Interface
+	userAgent   string
+	uaSuffix    string
+	cache       *responseCache
+	cacheTTL    time.Duration
+	cacheJitter float64
+
+	progressInterval       time.Duration
+	progress               func(downloaded, total int64) error
+	retryAttempts          int
+	retryDelay             time.Duration
+	downloadAttempts       int
+	downloadRetryDelay     time.Duration
+	downloadAttemptTimeout time.Duration
+	tempDir                string
+	retryPolicy            RetryPolicy
+	sortDevices            bool
+	dedupeDevices          bool
+	deviceSortKey          DeviceSortKey
+	skipSigningCheck       bool
+	preferSigned           bool
+	skipChecksum           bool
+	rawCapture             bool
+	maxConcurrency         int
+
+	timeout          time.Duration
+	maxResponseBytes int64
+	disableHTTP2     bool
+	limiter          *rate.Limiter
+	tracer           trace.Tracer
+	now              func() time.Time
+
+	closed *atomic.Bool
+}
+
+// defaultMaxResponseBytes is the default limit of an API response body, far larger than the biggest
+// payload (the devices catalog) but small enough to not run out of memory on a misbehaving server
+const defaultMaxResponseBytes = 64 << 20
+
+// defaultUserAgent is the User-Agent sent to the ipsw.me API unless overridden with WithUserAgent
+const defaultUserAgent = "ipsw/1.0"
+
+// ClientOption configures a Client
+type ClientOption func(*Client)
+
+// defaultClient is the Client used by the package-level ipsw.me functions
+var defaultClient atomic.Pointer[Client]
+
+func init() {
+	defaultClient.Store(NewClient())
+}
+
+// DefaultClient returns the Client used by the package-level ipsw.me functions
+func DefaultClient() *Client {
+	return defaultClient.Load()
+}
+
+// SetDefaultClient replaces the Client used by the package-level ipsw.me functions
+//
+// It is safe to call concurrently with the package-level functions, calls already in flight
+// keep using the previous client.
+func SetDefaultClient(c *Client) {
+	if c == nil {
+		c = NewClient()
+	}
+	defaultClient.Store(c)
+}
+
+// NewClient creates a new ipsw.me API client
+func NewClient(opts ...ClientOption) *Client {
+	c := &Client{
+		httpClient: http.DefaultClient,
+		baseURL:    ipswMeAPI,
+		logger:     log.Log,
+		userAgent:  defaultUserAgent,
+
+		maxResponseBytes: defaultMaxResponseBytes,
+
+		retryAttempts:      1,
+		retryDelay:         time.Second,
+		downloadAttempts:   1,
+		downloadRetryDelay: time.Second,
+		retryPolicy:        DefaultRetryPolicy,
+		maxConcurrency:     catalogConcurrency,
+
+		closed: &atomic.Bool{},
+		now:    time.Now,
+
+		sortDevices:   true,
+		dedupeDevices: true,
+		deviceSortKey: SortByIdentifier,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.finalize()
+	return c
+}
+
+// finalize sets up the state derived from the options
+func (c *Client) finalize() {
+	if c.timeout > 0 && c.httpClient.Timeout != c.timeout {
+		hc := *c.httpClient
+		hc.Timeout = c.timeout
+		c.httpClient = &hc
+	}
+	if c.disableHTTP2 {
+		if t, ok := c.transport(); ok && !http2Disabled(t) {
+			t = t.Clone()
+			t.ForceAttemptHTTP2 = false
+			// a non-nil empty map disables the transport's HTTP/2 upgrade
+			t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+			hc := *c.httpClient
+			hc.Transport = t
+			c.httpClient = &hc
+		}
+	}
+	if c.cacheTTL > 0 && c.cache == nil {
+		c.cache = newResponseCache(c.cacheTTL, c.cacheJitter, c.now)
+	}
+}
+
+// transport returns the client's *http.Transport, if it uses one
+func (c *Client) transport() (*http.Transport, bool) {
+	if c.httpClient.Transport == nil {
+		t, ok := http.DefaultTransport.(*http.Transport)
+		return t, ok
+	}
+	t, ok := c.httpClient.Transport.(*http.Transport)
+	return t, ok
+}
+
+// http2Disabled returns whether t was configured to only use HTTP/1.1
+func http2Disabled(t *http.Transport) bool {
+	return !t.ForceAttemptHTTP2 && t.TLSNextProto != nil && len(t.TLSNextProto) == 0
+}
+
+// with returns a copy of the client with per-call opts applied, leaving c untouched
+//
+// The copy shares the client's connection pool and cache, so WithCache/WithCacheJitter have no effect per call.
+func (c *Client) with(opts []ClientOption) *Client {
+	if len(opts) == 0 {
+		return c
+	}
+	cc := *c
+	for _, opt := range opts {
+		opt(&cc)
+	}
+	cc.finalize()
+	return &cc
+}
+
+// Close releases the resources held by the client: idle pooled connections and cached responses
+//
+// Requests and downloads started after Close (including the polls of a ReleaseFeed using the client,
+// which then stops polling) fail with ErrClientClosed, those already in flight are not interrupted.
+// It is safe to call Close multiple times.
+func (c *Client) Close() error {
+	if c.closed.CompareAndSwap(false, true) {
+		c.httpClient.CloseIdleConnections()
+		c.cache.clear()
+	}
+	return nil
+}
+
+// ClearCache drops every cached response (see WithCache) so the next lookups hit the API,
+// it does nothing when the cache is disabled
+func (c *Client) ClearCache() {
+	c.cache.clear()
+}
+
+// userAgentHeader returns the User-Agent sent with every request
+func (c *Client) userAgentHeader() string {
+	if c.uaSuffix != "" {
+		return c.userAgent + " " + c.uaSuffix
+	}
+	return c.userAgent
+}
+
+func (c *Client) setHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", c.userAgentHeader())
+}
+
+// do sends a GET request for the API endpoint at path (relative to the base URL) with extra headers
+//
+// Every API request goes through it so the headers and tracing are handled in one place.
+func (c *Client) do(ctx context.Context, path string, header http.Header) (res *http.Response, err error) {
+	ctx, span := c.startSpan(ctx, "ipsw.me GET", attrEndpoint.String(path))
+	defer func() { endSpan(span, err) }()
+
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+	if c.limiter != nil {
+		if err := c.waitLimiter(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http GET request: %v", err)
+	}
+	c.setHeaders(req)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	res, err = c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attrStatus.Int(res.StatusCode))
+	return res, nil
+}
+
+// waitLimiter waits for a slot of the rate limiter, reading the time from the client's clock
+// so the limiter follows WithClock like the rest of the client
+func (c *Client) waitLimiter(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := c.now()
+	r := c.limiter.ReserveN(now, 1)
+	delay := r.DelayFrom(now)
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		r.CancelAt(c.now())
+		return ctx.Err()
+	}
+}
+
+// WithHTTPClient sets the http.Client used for all requests
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *Client) {
+		if hc != nil {
+			c.httpClient = hc
+		}
+	}
+}
+
+// WithBaseURL sets the base URL of the ipsw.me API (https://api.ipsw.me/v4/ by default), e.g. for a mirror or a test server
+func WithBaseURL(baseURL string) ClientOption {
+	return func(c *Client) {
+		if baseURL != "" {
+			c.baseURL = strings.TrimSuffix(baseURL, "/") + "/"
+		}
+	}
+}
+
+// WithTimeout sets the time limit for each API request
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRateLimit limits API requests to rps per second across all calls made with the client
+// (unlimited by default or when rps <= 0), waiting for a slot unless the call's context is done first
+//
+// Slots are measured with the client's clock (see WithClock). It doesn't apply to the download functions.
+func WithRateLimit(rps float64) ClientOption {
+	return func(c *Client) {
+		if rps <= 0 {
+			c.limiter = nil
+			return
+		}
+		c.limiter = rate.NewLimiter(rate.Limit(rps), 1)
+	}
+}
+
+// WithTracer wraps API calls and downloads in OpenTelemetry spans created by tracer, as children
+// of any span in the context passed in (no tracing by default)
+func WithTracer(tracer trace.Tracer) ClientOption {
+	return func(c *Client) {
+		c.tracer = tracer
+	}
+}
+
+// WithHTTP2Disabled forces HTTP/1.1 for proxies that stall HTTP/2 requests (HTTP/2 is used by default)
+//
+// It has no effect when WithHTTPClient sets a client whose transport isn't an *http.Transport.
+func WithHTTP2Disabled() ClientOption {
+	return func(c *Client) {
+		c.disableHTTP2 = true
+	}
+}
+
+// WithMaxResponseBytes limits the size of API response bodies to n bytes (64 MiB by default),
+// larger responses fail with ErrResponseTooLarge; n <= 0 removes the limit
+//
+// It doesn't apply to the download functions.
+func WithMaxResponseBytes(n int64) ClientOption {
+	return func(c *Client) {
+		c.maxResponseBytes = n
+	}
+}
+
+// WithLogger sets the Logger used by the client
+func WithLogger(l log.Interface) ClientOption {
+	return func(c *Client) {
+		if l != nil {
+			c.logger = l
+		}
+	}
+}
+
+// WithProgressLogging makes the download functions emit a structured progress log line every interval
+func WithProgressLogging(interval time.Duration) ClientOption {
+	return func(c *Client) {
+		c.progressInterval = interval
+	}
+}
+
+// WithProgress makes the download functions call progress as data is received with the number of bytes
+// downloaded so far (including any resumed from a .part file) and the total (0 if unknown)
+//
+// Returning an error from progress aborts the download, which then returns that error as is without
+// retrying; the .part file is kept so the download can be resumed later.
+func WithProgress(progress func(downloaded, total int64) error) ClientOption {
+	return func(c *Client) {
+		c.progress = progress
+	}
+}
+
+// WithSort enables or disables sorting of the GetAllDevices results (enabled by default)
+func WithSort(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.sortDevices = enabled
+	}
+}
+
+// WithDedupe enables or disables collapsing duplicate identifiers in the GetAllDevices results with DedupeDevices (enabled by default)
+func WithDedupe(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.dedupeDevices = enabled
+	}
+}
+
+// WithSortKey sets the key GetAllDevices results are sorted by
+func WithSortKey(key DeviceSortKey) ClientOption {
+	return func(c *Client) {
+		c.sortDevices = true
+		c.deviceSortKey = key
+	}
+}
+
+// WithRetry makes the API functions retry failed requests up to maxAttempts times in total, waiting
+// an exponentially increasing, jittered delay starting at baseDelay between attempts
+//
+// Which failures are retried is decided by the RetryPolicy (5xx and 429 responses and network errors
+// by default), other 4xx responses are never retried. Cancelling the call's context stops the retries.
+func WithRetry(maxAttempts int, baseDelay time.Duration) ClientOption {
+	return func(c *Client) {
+		c.retryAttempts = maxAttempts
+		c.retryDelay = baseDelay
+	}
+}
+
+// WithDownloadRetry makes the download functions retry failed attempts up to maxAttempts times in total,
+// waiting an exponentially increasing delay starting at baseDelay between attempts
+func WithDownloadRetry(maxAttempts int, baseDelay time.Duration) ClientOption {
+	return func(c *Client) {
+		c.downloadAttempts = maxAttempts
+		c.downloadRetryDelay = baseDelay
+	}
+}
+
+// WithDownloadAttemptTimeout caps the duration of a single download attempt
+func WithDownloadAttemptTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.downloadAttemptTimeout = timeout
+	}
+}
+
+// WithMaxConcurrency sets the number of concurrent per-device requests made by lookups that scan
+// every device such as GetVersion (8 by default)
+func WithMaxConcurrency(n int) ClientOption {
+	return func(c *Client) {
+		c.maxConcurrency = max(n, 1)
+	}
+}
+
+// WithTempDir makes the download functions write the partial .part files to dir (e.g. fast local
+// storage when downloading to a network mount) and move them to the destination once complete
+func WithTempDir(dir string) ClientOption {
+	return func(c *Client) {
+		c.tempDir = dir
+	}
+}
+
+// WithUserAgent replaces the User-Agent sent with every request
+func WithUserAgent(ua string) ClientOption {
+	return func(c *Client) {
+		if ua == "" || strings.ContainsAny(ua, "\r\n") {
+			c.logger.Warnf("ignoring invalid User-Agent %q", ua)
+			return
+		}
+		c.userAgent = ua
+	}
+}
+
+// WithUserAgentSuffix appends " <suffix>" to the User-Agent to identify downstream tools (e.g. myapp/1.2)
+//
+// Suffixes containing CR or LF are ignored to prevent header injection.
+func WithUserAgentSuffix(suffix string) ClientOption {
+	return func(c *Client) {
+		if suffix == "" || strings.ContainsAny(suffix, "\r\n") {
+			c.logger.Warnf("ignoring invalid User-Agent suffix %q", suffix)
+			return
+		}
+		c.uaSuffix = suffix
+	}
+}
+
+// WithCache caches API responses in memory for ttl
+func WithCache(ttl time.Duration) ClientOption {
+	return func(c *Client) {
+		c.cacheTTL = ttl
+	}
+}
+
+// WithCacheJitter randomly shortens each cache entry's TTL by up to frac (0-1) of the TTL so entries
+// don't all expire at the same instant across a fleet (no jitter by default)
+func WithCacheJitter(frac float64) ClientOption {
+	return func(c *Client) {
+		c.cacheJitter = min(max(frac, 0), 1)
+	}
+}
+
+// WithSkipSigningCheck makes DownloadIfSigned download builds regardless of their signing status (e.g. for archiving)
+func WithSkipSigningCheck() ClientOption {
+	return func(c *Client) {
+		c.skipSigningCheck = true
+	}
+}
+
+// WithSkipChecksum makes DownloadIfMissing trust any existing file without reading it to verify its checksum
+// and DownloadTo stream the IPSW without computing its checksums
+func WithSkipChecksum() ClientOption {
+	return func(c *Client) {
+		c.skipChecksum = true
+	}
+}
+
+// WithPreferSigned makes GetLatestIPSW and GetLatestBuildID return the newest signed IPSW when there is one
+func WithPreferSigned() ClientOption {
+	return func(c *Client) {
+		c.preferSigned = true
+	}
+}
+
+// WithRetryPolicy sets the policy deciding which failures are retried (DefaultRetryPolicy by default)
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *Client) {
+		if policy != nil {
+			c.retryPolicy = policy
+		}
+	}
+}
+
+// WithClock replaces the source of the current time (time.Now by default) used for the
+// time-dependent logic such as cache expiry and rate limiting, meant for controlling time in tests
+func WithClock(now func() time.Time) ClientOption {
+	return func(c *Client) {
+		if now != nil {
+			c.now = now
+		}
+	}
+}
+
+// WithRawCapture enables the *Raw methods that also return the original JSON of a response
+func WithRawCapture() ClientOption {
+	return func(c *Client) {
+		c.rawCapture = true
+	}
+}
@@ -0,0 +1,863 @@
+package download
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/dustin/go-humanize"
+)
+
+// DownloadIPSW downloads an IPSW to dest using the DefaultClient
+func DownloadIPSW(ctx context.Context, i IPSW, dest string, opts ...ClientOption) error {
+	return DefaultClient().DownloadIPSW(ctx, i, dest, opts...)
+}
+
+// minDownloadAttempt is the least amount of time worth starting a download attempt with
+var minDownloadAttempt = 5 * time.Second
+
+// DownloadIPSW downloads an IPSW to dest
+//
+// The data is written to a dest.part file first (in the WithTempDir directory if set) which is
+// moved to dest once complete, if the .part file already exists the download is resumed from where it left off.
+//
+// Failed attempts are retried (resuming from the .part file) as configured by WithDownloadRetry.
+// All attempts share the ctx deadline: each attempt is given at most the time remaining and
+// ErrDeadlineTooShort is returned when too little time is left for a meaningful attempt.
+//
+// ErrNotDownloadable is returned without making any request when the IPSW has no URL or size.
+//
+// The SHA1 and MD5 checksums of the IPSW (when known) are computed while downloading and
+// ErrChecksumMismatch is returned, and the .part file removed, if they don't match.
+//
+// Concurrent downloads to the same destination (by absolute path) are serialized: a download that
+// had to wait returns early if the previous one left a file matching the IPSW's size and checksums at dest.
+func (c *Client) DownloadIPSW(ctx context.Context, i IPSW, dest string, opts ...ClientOption) error {
+	c = c.with(opts)
+	defer lockDest(dest)()
+	return c.downloadIPSW(ctx, i, dest)
+}
+
+// downloadIPSW is DownloadIPSW for callers already holding the dest lock
+func (c *Client) downloadIPSW(ctx context.Context, i IPSW, dest string) error {
+	if !i.IsDownloadable() {
+		return fmt.Errorf("%w: %s", ErrNotDownloadable, i)
+	}
+	return c.download(ctx, i.URL, i.FileSize, checksums{sha1: i.SHA1, md5: i.MD5}, dest)
+}
+
+// DownloadResume downloads the IPSW to path resuming from a partial file there using the DefaultClient
+func (i IPSW) DownloadResume(ctx context.Context, path string) error {
+	return DefaultClient().DownloadResume(ctx, i, path)
+}
+
+// DownloadResume downloads an IPSW to path resuming from the partial file already at path,
+// e.g. one left by a tool that downloads straight to its destination
+//
+// The partial file becomes the .part file of DownloadIPSW (unless the existing .part file is larger)
+// which resumes it with a range request, starting over if the server doesn't honor the range.
+// The completed file must have the IPSW's size and checksums.
+func (c *Client) DownloadResume(ctx context.Context, i IPSW, path string) error {
+	defer lockDest(path)()
+
+	if fi, err := os.Stat(path); err == nil && fi.Size() < i.FileSize {
+		part := c.partPath(path)
+		if pfi, err := os.Stat(part); err != nil || pfi.Size() < fi.Size() {
+			if err := moveFile(path, part); err != nil {
+				return fmt.Errorf("failed to move %s to %s: %v", path, part, err)
+			}
+		}
+	}
+	return c.downloadIPSW(ctx, i, path)
+}
+
+// Download streams the IPSW to w using the DefaultClient, see Client.DownloadTo
+func (i IPSW) Download(ctx context.Context, w io.Writer, progress func(downloaded, total int64)) (int64, error) {
+	return DefaultClient().DownloadTo(ctx, i, w, progress)
+}
+
+// DownloadTo streams an IPSW to w calling progress (if not nil) as data is written with the bytes
+// written so far and the IPSW's size, returning the number of bytes written even on failure
+//
+// The SHA1 and MD5 checksums of the IPSW (when known) are computed while streaming and
+// ErrChecksumMismatch is returned if they don't match, after all the data was written to w.
+// WithSkipChecksum disables the checksums.
+// Unlike DownloadIPSW a failed download is neither retried nor resumed.
+func (c *Client) DownloadTo(ctx context.Context, i IPSW, w io.Writer, progress func(downloaded, total int64)) (n int64, err error) {
+	if !i.IsDownloadable() {
+		return 0, fmt.Errorf("%w: %s", ErrNotDownloadable, i)
+	}
+	if c.closed.Load() {
+		return 0, ErrClientClosed
+	}
+
+	ctx, span := c.startSpan(ctx, "DownloadTo", attrEndpoint.String(i.URL), attrIdentifier.String(i.Identifier), attrBuild.String(i.BuildID))
+	defer func() {
+		span.SetAttributes(attrBytes.Int64(n))
+		endSpan(span, err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, i.URL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create http GET request: %v", err)
+	}
+	c.setHeaders(req)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, &NetworkError{Err: err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(res.Body, maxDrainBytes))
+		return 0, &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+	}
+
+	writers := []io.Writer{w}
+	var hashers map[string]hash.Hash
+	if !c.skipChecksum {
+		hashers = checksums{sha1: i.SHA1, md5: i.MD5}.hashers()
+	}
+	for _, h := range hashers {
+		writers = append(writers, h)
+	}
+	if progress != nil {
+		writers = append(writers, &progressCallback{
+			fn: func(downloaded, total int64) error {
+				progress(downloaded, total)
+				return nil
+			},
+			total: i.FileSize,
+		})
+	}
+
+	n, err = io.Copy(io.MultiWriter(writers...), res.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return n, ctx.Err()
+		}
+		return n, fmt.Errorf("failed to download %s: %w", i.URL, &NetworkError{Err: err})
+	}
+
+	for want, h := range hashers {
+		if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+			return n, fmt.Errorf("%w: %s has checksum %s, expected %s", ErrChecksumMismatch, i.URL, got, want)
+		}
+	}
+
+	return n, nil
+}
+
+// DownloadIfSigned downloads an IPSW to dest if it is currently signed using the DefaultClient
+func DownloadIfSigned(ctx context.Context, i IPSW, dest string) error {
+	return DefaultClient().DownloadIfSigned(ctx, i, dest)
+}
+
+// DownloadIfSigned downloads an IPSW to dest only if Apple is currently signing it, otherwise ErrNotSigned is returned
+//
+// The signing status is checked live with IsBuildSigned rather than trusting i.Signed,
+// use WithSkipSigningCheck to download unsigned builds anyway.
+func (c *Client) DownloadIfSigned(ctx context.Context, i IPSW, dest string) error {
+	if !i.IsDownloadable() {
+		return fmt.Errorf("%w: %s", ErrNotDownloadable, i)
+	}
+	if !c.skipSigningCheck {
+		signed, err := c.IsBuildSigned(i.Identifier, i.BuildID)
+		if err != nil {
+			return fmt.Errorf("failed to check signing status of %s: %w", i, err)
+		}
+		if !signed {
+			return fmt.Errorf("%w: %s", ErrNotSigned, i)
+		}
+	}
+	return c.DownloadIPSW(ctx, i, dest)
+}
+
+// DownloadIfMissing downloads an IPSW to dest unless it is already there using the DefaultClient
+func DownloadIfMissing(ctx context.Context, i IPSW, dest string) (bool, error) {
+	return DefaultClient().DownloadIfMissing(ctx, i, dest)
+}
+
+// DownloadIfMissing downloads an IPSW to dest unless a file matching its checksum is already there,
+// returning whether it was downloaded which makes re-running over the same directory cheap
+//
+// An existing file that doesn't match is replaced. Without known checksums the file size is compared
+// instead, and with WithSkipChecksum any existing file is trusted without being read.
+//
+// The check and the download are serialized with other operations on dest, so of several concurrent
+// calls for the same missing file only one downloads it and the others find it there.
+func (c *Client) DownloadIfMissing(ctx context.Context, i IPSW, dest string) (bool, error) {
+	defer lockDest(dest)()
+
+	fi, err := os.Stat(dest)
+	switch {
+	case err == nil:
+		ok, err := c.isDownloaded(i, dest, fi)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			c.logger.WithField("file", dest).Debug("already downloaded")
+			return false, nil
+		}
+		c.logger.WithField("file", dest).Warn("existing file doesn't match, downloading it again")
+		if err := os.Remove(dest); err != nil {
+			return false, fmt.Errorf("failed to remove %s: %v", dest, err)
+		}
+	case !os.IsNotExist(err):
+		return false, fmt.Errorf("failed to stat %s: %v", dest, err)
+	}
+
+	if err := c.downloadIPSW(ctx, i, dest); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RepairResult is what VerifyAndRepair had to do
+type RepairResult int
+
+const (
+	// RepairNone means the file was intact
+	RepairNone RepairResult = iota
+	// RepairMissing means the file was missing and has been downloaded
+	RepairMissing
+	// RepairCorrupt means the file didn't match its checksum (or size) and has been downloaded again
+	RepairCorrupt
+)
+
+// VerifyAndRepair verifies an archived IPSW using the DefaultClient
+func VerifyAndRepair(ctx context.Context, i IPSW, dest string) (RepairResult, error) {
+	return DefaultClient().VerifyAndRepair(ctx, i, dest)
+}
+
+// VerifyAndRepair verifies the file at dest against the IPSW's checksum (or size if it has none)
+// and downloads it again if it is missing or doesn't match, e.g. to detect bit-rot in an archive
+//
+// A file shorter than the IPSW is assumed truncated and the download resumes from it, if the result
+// still doesn't match the IPSW is downloaded from scratch. Any other mismatching file is replaced
+// by a fresh download. WithSkipChecksum is ignored as the point is to read the file.
+// It is serialized with other operations on dest.
+func (c *Client) VerifyAndRepair(ctx context.Context, i IPSW, dest string) (RepairResult, error) {
+	defer lockDest(dest)()
+
+	fi, err := os.Stat(dest)
+	if os.IsNotExist(err) {
+		return RepairMissing, c.downloadIPSW(ctx, i, dest)
+	} else if err != nil {
+		return RepairNone, fmt.Errorf("failed to stat %s: %v", dest, err)
+	}
+
+	verify := *c
+	verify.skipChecksum = false
+	ok, err := verify.isDownloaded(i, dest, fi)
+	if err != nil {
+		return RepairNone, err
+	}
+	if ok {
+		return RepairNone, nil
+	}
+
+	part := c.partPath(dest)
+	truncated := i.FileSize > 0 && fi.Size() < i.FileSize
+	if truncated {
+		c.logger.WithField("file", dest).Warn("file is truncated, resuming its download")
+		err = moveFile(dest, part)
+	} else {
+		c.logger.WithField("file", dest).Warn("file is corrupt, downloading it again")
+		err = os.Remove(dest)
+		if rerr := os.Remove(part); rerr != nil && !os.IsNotExist(rerr) && err == nil {
+			err = rerr
+		}
+	}
+	if err != nil {
+		return RepairCorrupt, fmt.Errorf("failed to discard %s: %v", dest, err)
+	}
+
+	err = c.downloadIPSW(ctx, i, dest)
+	if truncated && errors.Is(err, ErrChecksumMismatch) {
+		// the kept bytes were corrupt too, the mismatching .part file has been removed so start over
+		err = c.downloadIPSW(ctx, i, dest)
+	}
+
+	return RepairCorrupt, err
+}
+
+// isDownloaded returns whether the existing file at dest is the IPSW
+func (c *Client) isDownloaded(i IPSW, dest string, fi os.FileInfo) (bool, error) {
+	if c.skipChecksum {
+		return true, nil
+	}
+	return fileMatches(dest, fi, i.FileSize, checksums{sha1: i.SHA1, md5: i.MD5})
+}
+
+// fileMatches returns whether the file at path has the expected size (unless 0) and checksums
+func fileMatches(path string, fi os.FileInfo, size int64, sums checksums) (bool, error) {
+	if size > 0 && fi.Size() != size {
+		return false, nil
+	}
+	hashers := sums.hashers()
+	if len(hashers) == 0 {
+		return true, nil
+	}
+	if err := seedHashes(path, fi.Size(), hashers); err != nil {
+		return false, err
+	}
+	for want, h := range hashers {
+		if !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), want) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// VerifyFile checks the file at path against the IPSW's SHA1 and MD5 checksums, reading it once
+//
+// Empty checksums are skipped, a mismatch returns an error wrapping ErrChecksumMismatch that names the hash.
+// A file whose size isn't the IPSW's (when known) is a mismatch too, found without reading it.
+func (i IPSW) VerifyFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	if i.FileSize > 0 {
+		fi, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %v", path, err)
+		}
+		if fi.Size() != i.FileSize {
+			return fmt.Errorf("%w: %s is %d bytes, expected %d", ErrChecksumMismatch, path, fi.Size(), i.FileSize)
+		}
+	}
+
+	sha1sum, md5sum := sha1.New(), md5.New()
+	if _, err := io.Copy(io.MultiWriter(sha1sum, md5sum), f); err != nil {
+		return fmt.Errorf("failed to hash %s: %v", path, err)
+	}
+
+	for _, sum := range []struct {
+		name string
+		want string
+		h    hash.Hash
+	}{
+		{"SHA1", i.SHA1, sha1sum},
+		{"MD5", i.MD5, md5sum},
+	} {
+		if sum.want == "" {
+			continue
+		}
+		if got := hex.EncodeToString(sum.h.Sum(nil)); !strings.EqualFold(got, sum.want) {
+			return fmt.Errorf("%w: %s has %s %s, expected %s", ErrChecksumMismatch, path, sum.name, got, sum.want)
+		}
+	}
+
+	return nil
+}
+
+// DownloadOTA downloads an OTA to dest using the DefaultClient
+func DownloadOTA(ctx context.Context, o OTA, dest string, opts ...ClientOption) error {
+	return DefaultClient().DownloadOTA(ctx, o, dest, opts...)
+}
+
+// DownloadOTA downloads an OTA to dest, see DownloadIPSW for the resume and retry behavior
+func (c *Client) DownloadOTA(ctx context.Context, o OTA, dest string, opts ...ClientOption) error {
+	c = c.with(opts)
+	defer lockDest(dest)()
+	return c.download(ctx, o.URL, o.FileSize, checksums{}, dest)
+}
+
+// destLocks serializes downloads to the same destination within the process
+var destLocks = &keyedMutex{locks: make(map[string]*refMutex)}
+
+// lockDest locks dest (by absolute path) in destLocks and returns the function that unlocks it
+func lockDest(dest string) func() {
+	key, err := filepath.Abs(dest)
+	if err != nil {
+		key = dest
+	}
+	return destLocks.lock(key)
+}
+
+type refMutex struct {
+	sync.Mutex
+	refs int
+}
+
+// keyedMutex is a set of mutexes keyed by string that are freed once unused
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*refMutex
+}
+
+// lock locks key and returns the function that unlocks it
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	m, ok := k.locks[key]
+	if !ok {
+		m = &refMutex{}
+		k.locks[key] = m
+	}
+	m.refs++
+	k.mu.Unlock()
+
+	m.Lock()
+
+	return func() {
+		m.Unlock()
+		k.mu.Lock()
+		if m.refs--; m.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// checksums are the expected hex digests of a download, empty ones are not checked
+type checksums struct {
+	sha1 string
+	md5  string
+}
+
+// hashers returns the hashes to compute for the checksums that are set
+func (s checksums) hashers() map[string]hash.Hash {
+	hs := make(map[string]hash.Hash)
+	if s.sha1 != "" {
+		hs[s.sha1] = sha1.New()
+	}
+	if s.md5 != "" {
+		hs[s.md5] = md5.New()
+	}
+	return hs
+}
+
+// download downloads url (of the expected size, or 0 if unknown) to dest retrying failed attempts
+//
+// A file already at dest with the expected size is kept if it also matches the checksums,
+// otherwise it is downloaded again.
+//
+// The caller must hold the dest lock (see lockDest) for the whole operation.
+func (c *Client) download(ctx context.Context, url string, size int64, sums checksums, dest string) (err error) {
+	ctx, span := c.startSpan(ctx, "Download", attrEndpoint.String(url))
+	var downloaded int64
+	defer func() {
+		span.SetAttributes(attrBytes.Int64(downloaded))
+		endSpan(span, err)
+	}()
+
+	if c.closed.Load() {
+		return ErrClientClosed
+	}
+
+	if fi, err := os.Stat(dest); err == nil && size > 0 && fi.Size() == size {
+		ok, err := fileMatches(dest, fi, size, sums)
+		if err != nil {
+			return err
+		}
+		if ok {
+			c.logger.WithField("file", dest).Debug("already downloaded")
+			return nil
+		}
+		c.logger.WithField("file", dest).Warn("existing file doesn't match its checksum, downloading it again")
+	}
+
+	for attempt := 0; attempt < max(c.downloadAttempts, 1); attempt++ {
+		if attempt > 0 {
+			delay := c.downloadRetryDelay << (attempt - 1)
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline)-delay < minDownloadAttempt {
+				return fmt.Errorf("%w: %w", ErrDeadlineTooShort, err)
+			}
+			c.logger.WithError(err).Warnf("download attempt %d failed, retrying in %s", attempt, delay)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		attemptCtx := ctx
+		timeout := c.downloadAttemptTimeout
+		if deadline, ok := ctx.Deadline(); ok {
+			remaining := time.Until(deadline)
+			if remaining < minDownloadAttempt {
+				if err == nil {
+					return ErrDeadlineTooShort
+				}
+				return fmt.Errorf("%w: %w", ErrDeadlineTooShort, err)
+			}
+			if timeout <= 0 || remaining < timeout {
+				timeout = remaining
+			}
+		}
+		var cancel context.CancelFunc = func() {}
+		if timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		var n int64
+		n, err = c.downloadAttempt(attemptCtx, url, size, sums, dest)
+		downloaded += n
+		timedOut := attemptCtx.Err() != nil
+		cancel()
+		if err == nil {
+			return nil
+		}
+		var abort *progressAbort
+		if errors.As(err, &abort) {
+			return abort.err
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		// an attempt cut short by its own timeout is always worth retrying
+		if !timedOut && !c.shouldRetry(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// partPath returns the path of the partial download file for dest
+//
+// With WithTempDir the name includes a hash of dest's absolute path so downloads of files
+// with the same name to different directories don't share a .part file.
+func (c *Client) partPath(dest string) string {
+	if c.tempDir == "" {
+		return dest + ".part"
+	}
+	abs, err := filepath.Abs(dest)
+	if err != nil {
+		abs = dest
+	}
+	sum := sha1.Sum([]byte(abs))
+	return filepath.Join(c.tempDir, fmt.Sprintf("%s.%x.part", filepath.Base(dest), sum[:4]))
+}
+
+// renameFile is os.Rename, replaced in tests to simulate a move across filesystems
+var renameFile = os.Rename
+
+// moveFile renames src to dst, falling back to copying when they are on different filesystems
+//
+// The copy is written next to dst and renamed into place so dst never holds a partial file.
+func moveFile(src, dst string) error {
+	err := renameFile(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	// not dst.part which may be src itself
+	out, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.part")
+	if err != nil {
+		return err
+	}
+	tmp := out.Name()
+	if err := out.Chmod(fi.Mode().Perm()); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Remove(src)
+}
+
+// downloadAttempt makes a single attempt at downloading url to dest and returns the number of bytes received
+//
+// The checksums are computed as the data is written so the file is never read back once complete,
+// however when resuming the bytes already in the .part file must be hashed first as a hash can't be
+// restored from a previous attempt: only that prefix is read from disk, not the whole file.
+func (c *Client) downloadAttempt(ctx context.Context, url string, size int64, sums checksums, dest string) (int64, error) {
+	part := c.partPath(dest)
+
+	var offset int64
+	if fi, err := os.Stat(part); err == nil {
+		offset = fi.Size()
+	}
+	if size > 0 && offset > size {
+		// longer than the file itself so it can't be a prefix of it, start over
+		if err := os.Remove(part); err != nil {
+			return 0, fmt.Errorf("failed to remove %s: %v", part, err)
+		}
+		offset = 0
+	}
+	if size > 0 && offset == size {
+		// a previous attempt received everything but failed before moving the file into place
+		return 0, c.completePart(url, part, dest, offset, sums)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create http GET request: %v", err)
+	}
+	c.setHeaders(req)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, &NetworkError{Err: err}
+	}
+	defer res.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// server ignored the range request so start over
+		offset = 0
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the range starts at the end of the file when the .part file is already complete
+		if offset > 0 && res.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", offset) {
+			return 0, c.completePart(url, part, dest, offset, sums)
+		}
+		return 0, &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+	default:
+		return 0, &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+	}
+
+	total := size
+	if total <= 0 && res.ContentLength > 0 {
+		total = offset + res.ContentLength
+	}
+
+	f, err := os.OpenFile(part, flags, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %v", part, err)
+	}
+
+	writers := []io.Writer{f}
+	hashers := sums.hashers()
+	for _, h := range hashers {
+		writers = append(writers, h)
+	}
+	if offset > 0 && len(hashers) > 0 {
+		if err := seedHashes(part, offset, hashers); err != nil {
+			f.Close()
+			return 0, err
+		}
+	}
+	if c.progressInterval > 0 {
+		p := newProgressLogger(c.logger, c.progressInterval, dest, offset, total)
+		p.start()
+		defer p.stop()
+		writers = append(writers, p)
+	}
+	if c.progress != nil {
+		writers = append(writers, &progressCallback{fn: c.progress, downloaded: offset, total: total})
+	}
+	w := io.MultiWriter(writers...)
+
+	n, err := io.Copy(w, res.Body)
+	if err != nil {
+		f.Close()
+		var abort *progressAbort
+		if errors.As(err, &abort) {
+			return n, abort
+		}
+		return n, fmt.Errorf("failed to download %s: %w", url, &NetworkError{Err: err})
+	}
+	if err := f.Close(); err != nil {
+		return n, fmt.Errorf("failed to close %s: %v", part, err)
+	}
+	if size > 0 && offset+n != size {
+		// the server sent a complete response of the wrong size, resuming from it wouldn't help
+		os.Remove(part)
+		return n, fmt.Errorf("%s is %d bytes, expected %d", url, offset+n, size)
+	}
+
+	return n, finishPart(url, part, dest, hashers)
+}
+
+// completePart finishes a download whose .part file already holds all of its size bytes
+func (c *Client) completePart(url, part, dest string, size int64, sums checksums) error {
+	c.logger.WithField("file", dest).Debug("partial download is already complete")
+	hashers := sums.hashers()
+	if len(hashers) > 0 {
+		if err := seedHashes(part, size, hashers); err != nil {
+			return err
+		}
+	}
+	return finishPart(url, part, dest, hashers)
+}
+
+// finishPart checks the hashes of a complete .part file, removing it if they don't match, and moves it to dest
+func finishPart(url, part, dest string, hashers map[string]hash.Hash) error {
+	for want, h := range hashers {
+		if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+			os.Remove(part)
+			return fmt.Errorf("%w: %s has checksum %s, expected %s", ErrChecksumMismatch, url, got, want)
+		}
+	}
+
+	if err := moveFile(part, dest); err != nil {
+		return fmt.Errorf("failed to move %s to %s: %v", part, dest, err)
+	}
+
+	return nil
+}
+
+// seedHashes feeds the first n bytes of the file at path to the hashers
+func seedHashes(path string, n int64, hashers map[string]hash.Hash) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	writers := make([]io.Writer, 0, len(hashers))
+	for _, h := range hashers {
+		writers = append(writers, h)
+	}
+	if _, err := io.CopyN(io.MultiWriter(writers...), f, n); err != nil {
+		return fmt.Errorf("failed to hash %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// progressCallback reports the progress of a download to the WithProgress callback
+type progressCallback struct {
+	fn         func(downloaded, total int64) error
+	downloaded int64
+	total      int64
+}
+
+// progressAbort carries the error a WithProgress callback aborted a download with
+type progressAbort struct {
+	err error
+}
+
+func (e *progressAbort) Error() string {
+	return e.err.Error()
+}
+
+func (p *progressCallback) Write(b []byte) (int, error) {
+	p.downloaded += int64(len(b))
+	if err := p.fn(p.downloaded, p.total); err != nil {
+		return 0, &progressAbort{err: err}
+	}
+	return len(b), nil
+}
+
+// progressLogger periodically logs the progress of a download
+type progressLogger struct {
+	logger   log.Interface
+	interval time.Duration
+	name     string
+	total    int64
+
+	downloaded atomic.Int64
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+func newProgressLogger(logger log.Interface, interval time.Duration, name string, offset, total int64) *progressLogger {
+	p := &progressLogger{
+		logger:   logger,
+		interval: interval,
+		name:     name,
+		total:    total,
+		done:     make(chan struct{}),
+	}
+	p.downloaded.Store(offset)
+	return p
+}
+
+func (p *progressLogger) Write(b []byte) (int, error) {
+	p.downloaded.Add(int64(len(b)))
+	return len(b), nil
+}
+
+func (p *progressLogger) start() {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		last := p.downloaded.Load()
+		lastTime := time.Now()
+		for {
+			select {
+			case <-p.done:
+				// always emit the final line so logs end on the completed state
+				now := time.Now()
+				downloaded := p.downloaded.Load()
+				p.log(downloaded, speed(downloaded-last, now.Sub(lastTime)))
+				return
+			case now := <-ticker.C:
+				downloaded := p.downloaded.Load()
+				p.log(downloaded, speed(downloaded-last, now.Sub(lastTime)))
+				last, lastTime = downloaded, now
+			}
+		}
+	}()
+}
+
+func (p *progressLogger) stop() {
+	close(p.done)
+	p.wg.Wait()
+}
+
+func (p *progressLogger) log(downloaded int64, bps float64) {
+	var percent float64
+	if p.total > 0 {
+		percent = float64(downloaded) / float64(p.total) * 100
+	}
+	p.logger.WithFields(log.Fields{
+		"file":       p.name,
+		"downloaded": humanize.Bytes(uint64(downloaded)),
+		"total":      humanize.Bytes(uint64(p.total)),
+		"percent":    fmt.Sprintf("%.1f%%", percent),
+		"speed":      humanize.Bytes(uint64(bps)) + "/s",
+	}).Info("Downloading")
+}
+
+// speed returns the average bytes per second transferred over a window
+func speed(n int64, window time.Duration) float64 {
+	if window <= 0 {
+		return 0
+	}
+	return float64(n) / window.Seconds()
+}
@@ -0,0 +1,138 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrUnexpectedContent is returned when the API responds with something other than JSON (e.g. an HTML error page)
+var ErrUnexpectedContent = errors.New("api returned unexpected non-JSON content")
+
+// ErrEmptyResponse is returned when the API responds with an empty or null body where data is expected
+var ErrEmptyResponse = errors.New("api returned an empty response")
+
+// ErrUnexpectedShape is returned when the API responds with a JSON array where an object is expected or vice versa
+var ErrUnexpectedShape = errors.New("api returned JSON of an unexpected shape")
+
+// ErrNotSigned is returned when refusing to download a build that Apple is no longer signing
+var ErrNotSigned = errors.New("build is not signed")
+
+// ErrDeviceNotFound is returned when the API doesn't know a device identifier
+var ErrDeviceNotFound = errors.New("device not found")
+
+// ErrBuildNotFound is returned when no build matches a lookup
+var ErrBuildNotFound = errors.New("build not found")
+
+// ErrVersionNotFound is returned when a build ID doesn't match any version
+var ErrVersionNotFound = errors.New("version not found")
+
+// ErrNoSignedFirmware is returned when Apple isn't signing any of a device's IPSWs
+var ErrNoSignedFirmware = errors.New("no signed firmware")
+
+// ErrNotDownloadable is returned when refusing to download an IPSW whose artifact isn't published yet
+var ErrNotDownloadable = errors.New("ipsw is not downloadable")
+
+// ErrChecksumMismatch is returned when a downloaded file doesn't match its expected checksum
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrResponseTooLarge is returned when an API response body exceeds the WithMaxResponseBytes limit
+var ErrResponseTooLarge = errors.New("api response is too large")
+
+// ErrDeadlineTooShort is returned when the time left before the context deadline is too short for another download attempt
+var ErrDeadlineTooShort = errors.New("not enough time left before the context deadline for a download attempt")
+
+// ErrClientClosed is returned by the requests and downloads of a Client after it was closed
+var ErrClientClosed = errors.New("client is closed")
+
+// RetryableError is implemented by errors that may succeed if the request is retried
+//
+// The following errors are classified as retryable:
+//   - network errors (connection refused/reset, DNS failures, timeouts), except context cancellation
+//   - 5xx server errors
+//   - 429 Too Many Requests
+type RetryableError interface {
+	error
+	Retryable() bool
+}
+
+// IsRetryable returns whether err (or any error it wraps) is classified as retryable
+func IsRetryable(err error) bool {
+	var re RetryableError
+	if errors.As(err, &re) {
+		return re.Retryable()
+	}
+	return false
+}
+
+// StatusError is returned when the server responds with an unexpected HTTP status
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("api returned status: %s", e.Status)
+}
+
+// Retryable returns true for 5xx and 429 statuses
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
+}
+
+// Temporary is an alias for Retryable
+func (e *StatusError) Temporary() bool {
+	return e.Retryable()
+}
+
+// NetworkError is returned when a request fails before a response is received
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable returns true unless the request was cancelled by its context or the client is closed
+func (e *NetworkError) Retryable() bool {
+	return !errors.Is(e.Err, context.Canceled) && !errors.Is(e.Err, context.DeadlineExceeded) && !errors.Is(e.Err, ErrClientClosed)
+}
+
+// Temporary is an alias for Retryable
+func (e *NetworkError) Temporary() bool {
+	return e.Retryable()
+}
+
+// RetryPolicy decides whether a failed request should be retried given its HTTP status
+// (0 if no response was received) and error, it is never called for successful responses
+type RetryPolicy func(status int, err error) bool
+
+// DefaultRetryPolicy retries 5xx and 429 responses and network errors
+func DefaultRetryPolicy(status int, err error) bool {
+	if status != 0 {
+		return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+	}
+	return IsRetryable(err)
+}
+
+// isNotFound returns whether err is a 404 response
+func isNotFound(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.StatusCode == http.StatusNotFound
+}
+
+// shouldRetry consults the client's retry policy for a failed request
+func (c *Client) shouldRetry(err error) bool {
+	var status int
+	var se *StatusError
+	if errors.As(err, &se) {
+		status = se.StatusCode
+	}
+	return c.retryPolicy(status, err)
+}
@@ -0,0 +1,171 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// defaultReleaseFeedInterval is the poll interval of a ReleaseFeed created with a non-positive interval
+const defaultReleaseFeedInterval = 5 * time.Minute
+
+// ReleaseFeed polls the releases feed and notifies its subscribers of new releases
+//
+// The first poll only records the releases already published, subscribers are then called
+// with the releases (by build ID) that appear in later polls, each release is notified once.
+// Polls are conditional requests (If-None-Match) so an unchanged feed costs a 304 response.
+type ReleaseFeed struct {
+	client   *Client
+	interval time.Duration
+
+	mu          sync.Mutex
+	subscribers []func([]Release)
+
+	// only used by the polling goroutine
+	known map[string]bool
+	etag  string
+
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewReleaseFeed starts polling the releases feed with client (the DefaultClient if nil) every pollInterval
+// (5 minutes if <= 0) until Close is called or the client is closed
+func NewReleaseFeed(client *Client, pollInterval time.Duration) *ReleaseFeed {
+	if client == nil {
+		client = DefaultClient()
+	}
+	if pollInterval <= 0 {
+		pollInterval = defaultReleaseFeedInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &ReleaseFeed{
+		client:   client,
+		interval: pollInterval,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go f.run(ctx)
+
+	return f
+}
+
+// Subscribe registers fn to be called with the new releases found by each poll
+//
+// fn is called from the polling goroutine so a slow fn delays the next poll.
+func (f *ReleaseFeed) Subscribe(fn func(releases []Release)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subscribers = append(f.subscribers, fn)
+}
+
+// Close stops polling and waits for an in-flight poll to finish, it is safe to call multiple times
+func (f *ReleaseFeed) Close() error {
+	f.closeOnce.Do(func() {
+		f.cancel()
+		<-f.done
+	})
+	return nil
+}
+
+func (f *ReleaseFeed) run(ctx context.Context) {
+	defer close(f.done)
+
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		f.poll(ctx)
+		if f.client.closed.Load() {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f *ReleaseFeed) poll(ctx context.Context) {
+	releases, etag, modified, err := f.client.getReleasesIfModified(ctx, f.etag)
+	if err != nil {
+		if ctx.Err() == nil && !errors.Is(err, ErrClientClosed) {
+			f.client.logger.WithError(err).Warn("failed to poll ipsw.me releases")
+		}
+		return
+	}
+	if !modified {
+		return
+	}
+	f.etag = etag
+
+	baseline := f.known == nil
+	if baseline {
+		f.known = make(map[string]bool, len(releases))
+	}
+	fresh := []Release{}
+	for _, r := range releases {
+		if !f.known[r.BuildID] {
+			f.known[r.BuildID] = true
+			fresh = append(fresh, r)
+		}
+	}
+	if baseline || len(fresh) == 0 {
+		return
+	}
+
+	f.mu.Lock()
+	subscribers := slices.Clone(f.subscribers)
+	f.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(slices.Clone(fresh))
+	}
+}
+
+// getReleasesIfModified returns the releases unless they are unchanged since the response with etag,
+// along with the ETag of the response and whether the releases were modified
+//
+// The response cache is bypassed as a cached feed would hide new releases.
+func (c *Client) getReleasesIfModified(ctx context.Context, etag string) ([]Release, string, bool, error) {
+	var header http.Header
+	if etag != "" {
+		header = http.Header{"If-None-Match": {etag}}
+	}
+	res, err := c.do(ctx, "releases", header)
+	if err != nil {
+		return nil, "", false, &NetworkError{Err: err}
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotModified:
+		return nil, etag, false, nil
+	case http.StatusOK:
+	default:
+		return nil, "", false, &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+	}
+
+	body, err := c.readBody(c.baseURL+"releases", res)
+	if err != nil {
+		return nil, "", false, err
+	}
+	releases := []Release{}
+	if err := checkEmpty("releases", body); err != nil {
+		return nil, "", false, err
+	}
+	if err := checkShape("releases", body, &releases); err != nil {
+		return nil, "", false, err
+	}
+	if err := json.Unmarshal(body, &releases); err != nil {
+		return nil, "", false, err
+	}
+
+	return releases, res.Header.Get("ETag"), true, nil
+}
@@ -0,0 +1,128 @@
+package download
+
+import (
+	"cmp"
+	"strconv"
+	"strings"
+)
+
+// Device platforms
+const (
+	PlatformIPhoneOS  = "iphoneos"
+	PlatformIPadOS    = "ipados"
+	PlatformAppleTVOS = "appletvos"
+	PlatformWatchOS   = "watchos"
+	PlatformAudioOS   = "audioos"
+	PlatformMacOS     = "macos"
+	PlatformBridgeOS  = "bridgeos"
+)
+
+// identifierPrefixes are the canonical spellings of device identifier prefixes
+var identifierPrefixes = []string{
+	"AudioAccessory",
+	"AppleTV",
+	"iBridge",
+	"iPhone",
+	"iPad",
+	"iPod",
+	"Watch",
+	"MacBookAir",
+	"MacBookPro",
+	"MacBook",
+	"Macmini",
+	"MacPro",
+	"iMacPro",
+	"iMac",
+	"Mac",
+}
+
+// macIdentifierPrefixes are the identifier prefixes of Macs (including Apple Silicon virtual machines)
+var macIdentifierPrefixes = []string{
+	"MacBookAir",
+	"MacBookPro",
+	"MacBook",
+	"Macmini",
+	"MacPro",
+	"iMacPro",
+	"iMac",
+	"Mac",
+	"VirtualMac",
+	"VMA2MacOSAP",
+}
+
+// IsMac returns whether the identifier is a Mac e.g. Mac14,2, MacBookPro18,1 or VMA2MacOSAP
+func IsMac(identifier string) bool {
+	identifier = NormalizeIdentifier(identifier)
+	for _, prefix := range macIdentifierPrefixes {
+		if strings.HasPrefix(identifier, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeIdentifier canonicalizes a device identifier typed by a user e.g. "iphone 15 ,2" → "iPhone15,2"
+//
+// Whitespace is removed and known prefixes (iPhone, iPad, iPod, Watch, AppleTV, AudioAccessory, iBridge and
+// the Mac families) get their canonical casing, identifiers with an unknown prefix are only stripped of whitespace.
+func NormalizeIdentifier(s string) string {
+	s = strings.Join(strings.Fields(s), "")
+	for _, prefix := range identifierPrefixes {
+		if len(s) > len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+			rest := s[len(prefix):]
+			if rest[0] >= '0' && rest[0] <= '9' {
+				return prefix + rest
+			}
+		}
+	}
+	return s
+}
+
+// deviceFamilies maps identifier prefixes to the device family returned by DeviceFamily
+var deviceFamilies = []struct {
+	prefix string
+	family string
+}{
+	{"AudioAccessory", "HomePod"},
+	{"AppleTV", "AppleTV"},
+	{"iPhone", "iPhone"},
+	{"iPad", "iPad"},
+	{"iPod", "iPod"},
+	{"Watch", "Watch"},
+}
+
+// DeviceFamily returns the family of a device identifier: "iPhone", "iPad", "Watch", "AppleTV", "HomePod",
+// "iPod", "Mac" or "unknown" (e.g. iBridge2,1), from the identifier alone without any request
+func DeviceFamily(identifier string) string {
+	identifier = NormalizeIdentifier(identifier)
+	if IsMac(identifier) {
+		return "Mac"
+	}
+	for _, f := range deviceFamilies {
+		if strings.HasPrefix(identifier, f.prefix) {
+			return f.family
+		}
+	}
+	return "unknown"
+}
+
+// identifierGeneration returns the generation numbers of a device identifier e.g. iPhone15,2 → 15, 2
+//
+// Identifiers without them (e.g. VMA2MacOSAP) are generation 0, 0.
+func identifierGeneration(identifier string) (major, minor int) {
+	idx := strings.IndexFunc(identifier, func(r rune) bool { return r >= '0' && r <= '9' })
+	if idx < 0 {
+		return 0, 0
+	}
+	majorStr, minorStr, _ := strings.Cut(identifier[idx:], ",")
+	major, _ = strconv.Atoi(majorStr)
+	minor, _ = strconv.Atoi(minorStr)
+	return major, minor
+}
+
+// compareIdentifiers orders device identifiers by generation (so iPhone9,1 < iPhone15,2) and then by name
+func compareIdentifiers(a, b string) int {
+	aMajor, aMinor := identifierGeneration(a)
+	bMajor, bMinor := identifierGeneration(b)
+	return cmp.Or(cmp.Compare(aMajor, bMajor), cmp.Compare(aMinor, bMinor), cmp.Compare(a, b))
+}
@@ -0,0 +1,104 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Key is a firmware image decryption key
+type Key struct {
+	Image    string `json:"image,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	KBag     string `json:"kbag,omitempty"`
+	Key      string `json:"key,omitempty"`
+	IV       string `json:"iv,omitempty"`
+}
+
+// FirmwareKeys are the published decryption keys for a device's build
+type FirmwareKeys struct {
+	Identifier string `json:"identifier,omitempty"`
+	BuildID    string `json:"buildid,omitempty"`
+	Codename   string `json:"codename,omitempty"`
+	Baseband   string `json:"baseband,omitempty"`
+	Keys       []Key  `json:"keys,omitempty"`
+}
+
+// GetKeys returns the published firmware keys for a device's build using the DefaultClient
+func GetKeys(identifier, buildID string, opts ...ClientOption) (FirmwareKeys, error) {
+	return DefaultClient().GetKeys(identifier, buildID, opts...)
+}
+
+// GetKeys returns the published firmware keys for a device's build, or an empty FirmwareKeys
+// if no keys are published for it
+func (c *Client) GetKeys(identifier, buildID string, opts ...ClientOption) (FirmwareKeys, error) {
+	fk, err := c.with(opts).getKeys(context.Background(), identifier, buildID)
+	if err != nil {
+		return FirmwareKeys{}, err
+	}
+	if len(fk.Keys) == 0 {
+		return FirmwareKeys{}, nil
+	}
+	return fk, nil
+}
+
+func (c *Client) getKeys(ctx context.Context, identifier, buildID string) (FirmwareKeys, error) {
+	var fk FirmwareKeys
+	identifier = NormalizeIdentifier(identifier)
+
+	err := c.getJSON(ctx, "keys/ipsw/"+identifier+"/"+buildID, &fk)
+	return fk, err
+}
+
+// GetDeviceFirmwareKeys returns all published firmware keys for a device using the DefaultClient
+func GetDeviceFirmwareKeys(ctx context.Context, identifier string) (map[string][]Key, error) {
+	return DefaultClient().GetDeviceFirmwareKeys(ctx, identifier)
+}
+
+// GetDeviceFirmwareKeys returns all published firmware keys for a device keyed by build ID
+//
+// The keys listed by the device's keys endpoint are used as is, only the builds it lists without
+// their keys are fetched one by one (see WithMaxConcurrency), the first failure cancels the others.
+// Builds without any published keys are omitted from the map.
+func (c *Client) GetDeviceFirmwareKeys(ctx context.Context, identifier string) (map[string][]Key, error) {
+	var builds []FirmwareKeys
+	identifier = NormalizeIdentifier(identifier)
+
+	if err := c.getJSON(ctx, "keys/device/"+identifier, &builds); err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	keys := make(map[string][]Key)
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(c.maxConcurrency)
+	for _, b := range builds {
+		if len(b.Keys) > 0 {
+			mu.Lock()
+			keys[b.BuildID] = b.Keys
+			mu.Unlock()
+			continue
+		}
+		g.Go(func() error {
+			fk, err := c.getKeys(ctx, identifier, b.BuildID)
+			if err != nil {
+				return fmt.Errorf("failed to get %s %s keys: %w", identifier, b.BuildID, err)
+			}
+			if len(fk.Keys) == 0 {
+				return nil
+			}
+			mu.Lock()
+			keys[b.BuildID] = fk.Keys
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
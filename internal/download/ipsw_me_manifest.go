@@ -0,0 +1,129 @@
+package download
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ipswFilenameRe matches Apple's canonical IPSW filename e.g. iPhone12,8_16.3.1_20D67_Restore.ipsw
+var ipswFilenameRe = regexp.MustCompile(`^(.+)_(\d+(?:\.\d+)*)_(\d+[A-Z]\d+[a-z]?)_Restore\.ipsw$`)
+
+// ParseIPSWFilename extracts the identifier, version and build from Apple's canonical IPSW filename
+// e.g. iPhone12,8_16.3.1_20D67_Restore.ipsw
+//
+// Multi-device IPSWs return the comma separated list of identifiers as is (e.g. iPhone15,4,iPhone15,5).
+func ParseIPSWFilename(name string) (identifier, version, build string, err error) {
+	m := ipswFilenameRe.FindStringSubmatch(filepath.Base(name))
+	if m == nil {
+		return "", "", "", fmt.Errorf("%s does not match the <identifier>_<version>_<build>_Restore.ipsw naming", filepath.Base(name))
+	}
+	return m[1], m[2], m[3], nil
+}
+
+// firstIdentifierRe matches the first device identifier of a (possibly multi-device) identifier list
+var firstIdentifierRe = regexp.MustCompile(`^[A-Za-z]+\d+,\d+`)
+
+// EnrichFromFilename returns the full IPSW metadata for an IPSW filename using the DefaultClient
+func EnrichFromFilename(name string) (IPSW, error) {
+	return DefaultClient().EnrichFromFilename(name)
+}
+
+// EnrichFromFilename parses an IPSW filename with ParseIPSWFilename and resolves its full metadata from the API
+//
+// For multi-device IPSWs the first device's metadata is returned.
+func (c *Client) EnrichFromFilename(name string) (IPSW, error) {
+	identifier, _, build, err := ParseIPSWFilename(name)
+	if err != nil {
+		return IPSW{}, err
+	}
+	if id := firstIdentifierRe.FindString(identifier); id != "" {
+		identifier = id
+	}
+	return c.GetIPSW(identifier, build)
+}
+
+// GetIPSWByURL returns the full IPSW metadata for an IPSW download URL using the DefaultClient
+func GetIPSWByURL(ipswURL string) (IPSW, error) {
+	return DefaultClient().GetIPSWByURL(ipswURL)
+}
+
+// GetIPSWByURL resolves the full IPSW metadata for an Apple (or ipsw.me) IPSW download URL
+// from the identifier and build of its filename, see EnrichFromFilename
+func (c *Client) GetIPSWByURL(ipswURL string) (IPSW, error) {
+	u, err := url.Parse(ipswURL)
+	if err != nil {
+		return IPSW{}, fmt.Errorf("failed to parse IPSW URL %s: %v", ipswURL, err)
+	}
+	if _, _, _, err := ParseIPSWFilename(path.Base(u.Path)); err != nil {
+		return IPSW{}, fmt.Errorf("failed to parse IPSW URL %s: %v", ipswURL, err)
+	}
+	return c.EnrichFromFilename(path.Base(u.Path))
+}
+
+// GenerateManifest returns the IPSWs found in a directory using the DefaultClient
+func GenerateManifest(dir string) ([]IPSW, error) {
+	return DefaultClient().GenerateManifest(dir)
+}
+
+// GenerateManifest scans a directory of .ipsw files and returns an IPSW for each one with the
+// identifier, version and build parsed from its filename and the SHA1 and size computed from its contents
+//
+// Files that don't follow Apple's naming are logged and skipped rather than aborting the scan.
+func (c *Client) GenerateManifest(dir string) ([]IPSW, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %v", dir, err)
+	}
+
+	ipsws := []IPSW{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".ipsw") {
+			continue
+		}
+
+		identifier, version, build, err := ParseIPSWFilename(entry.Name())
+		if err != nil {
+			c.logger.WithError(err).Warn("skipping IPSW")
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		sum, size, err := sha1File(path)
+		if err != nil {
+			return nil, err
+		}
+
+		ipsws = append(ipsws, IPSW{
+			Identifier: identifier,
+			Version:    version,
+			BuildID:    build,
+			SHA1:       sum,
+			FileSize:   size,
+		})
+	}
+
+	return ipsws, nil
+}
+
+func sha1File(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	h := sha1.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to hash %s: %v", path, err)
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), n, nil
+}
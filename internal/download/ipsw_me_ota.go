@@ -0,0 +1,201 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// OTA struct
+type OTA struct {
+	Identifier          string    `json:"identifier,omitempty"`
+	Version             string    `json:"version,omitempty"`
+	BuildID             string    `json:"buildid,omitempty"`
+	PrerequisiteBuildID string    `json:"prerequisitebuildid,omitempty"`
+	PrerequisiteVersion string    `json:"prerequisiteversion,omitempty"`
+	ReleaseType         string    `json:"releasetype,omitempty"`
+	FileSize            int64     `json:"filesize,omitempty"`
+	URL                 string    `json:"url,omitempty"`
+	ReleaseDate         time.Time `json:"releasedate"`
+	UploadDate          time.Time `json:"uploaddate"`
+	Signed              bool      `json:"signed,omitempty"`
+}
+
+// GetDeviceOTAs returns a device's OTAs from its identifier
+func GetDeviceOTAs(identifier string, opts ...ClientOption) ([]OTA, error) {
+	return DefaultClient().GetDeviceOTAs(identifier, opts...)
+}
+
+// GetDeviceOTAs returns a device's OTAs from its identifier
+func (c *Client) GetDeviceOTAs(identifier string, opts ...ClientOption) ([]OTA, error) {
+	c = c.with(opts)
+	var d struct {
+		Firmwares []OTA `json:"firmwares,omitempty"`
+	}
+	identifier = NormalizeIdentifier(identifier)
+
+	if err := c.getJSON(context.Background(), "device/"+identifier+"?type=ota", &d); err != nil {
+		return nil, err
+	}
+
+	return d.Firmwares, nil
+}
+
+// GetOTA returns a device's OTA for a build ID
+func GetOTA(identifier, buildID string, opts ...ClientOption) (OTA, error) {
+	return DefaultClient().GetOTA(identifier, buildID, opts...)
+}
+
+// GetOTA returns a device's OTA for a build ID
+//
+// A build can have several delta OTAs (one per prerequisite build), the API returns one of them;
+// use GetDeviceOTAs to pick the one updating from a given build.
+func (c *Client) GetOTA(identifier, buildID string, opts ...ClientOption) (o OTA, err error) {
+	c = c.with(opts)
+	identifier = NormalizeIdentifier(identifier)
+	ctx, span := c.startSpan(context.Background(), "GetOTA", attrIdentifier.String(identifier), attrBuild.String(buildID))
+	defer func() { endSpan(span, err) }()
+
+	err = c.getJSON(ctx, "ota/download/"+identifier+"/"+buildID, &o)
+	return o, err
+}
+
+// UpgradePath is the kind of download used to update a device
+type UpgradePath string
+
+const (
+	// UpgradePathOTA is a chain of delta OTA updates
+	UpgradePathOTA UpgradePath = "ota"
+	// UpgradePathFullRestore is a full IPSW restore
+	UpgradePathFullRestore UpgradePath = "ipsw"
+)
+
+// UpgradeDownloadSize returns the download size to update a device between builds using the DefaultClient
+func UpgradeDownloadSize(identifier, fromBuild, toBuild string) (int64, UpgradePath, error) {
+	return DefaultClient().UpgradeDownloadSize(identifier, fromBuild, toBuild)
+}
+
+// UpgradeDownloadSize returns the number of bytes that need to be downloaded to update a device from one build to another
+//
+// The smallest chain of delta OTAs (following each OTA's prerequisite build) is used when one exists,
+// otherwise the size of the full IPSW is returned. The returned UpgradePath reports which was used.
+// A device already on toBuild needs nothing, which is reported as an empty OTA chain.
+func (c *Client) UpgradeDownloadSize(identifier, fromBuild, toBuild string) (int64, UpgradePath, error) {
+	if fromBuild == toBuild {
+		return 0, UpgradePathOTA, nil
+	}
+
+	otas, err := c.GetDeviceOTAs(identifier)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get %s OTAs: %w", identifier, err)
+	}
+
+	if chain := otaChain(otas, fromBuild, toBuild); chain != nil {
+		var size int64
+		for _, o := range chain {
+			size += o.FileSize
+		}
+		return size, UpgradePathOTA, nil
+	}
+
+	i, err := c.GetIPSW(identifier, toBuild)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get %s IPSW for build %s: %w", identifier, toBuild, err)
+	}
+
+	return i.FileSize, UpgradePathFullRestore, nil
+}
+
+// otaChain returns the chain of delta OTAs with the smallest total size that updates fromBuild to toBuild
+// in the order they need to be applied, or nil if there is no such chain
+func otaChain(otas []OTA, fromBuild, toBuild string) []OTA {
+	if fromBuild == toBuild {
+		return nil
+	}
+
+	// shortest path (by total size) over builds where every delta OTA is an edge prerequisite → build
+	size := map[string]int64{fromBuild: 0}
+	via := make(map[string]OTA)
+	for changed := true; changed; {
+		changed = false
+		for _, o := range otas {
+			if o.PrerequisiteBuildID == "" || o.FileSize <= 0 {
+				continue
+			}
+			s, ok := size[o.PrerequisiteBuildID]
+			if !ok {
+				continue
+			}
+			if cur, ok := size[o.BuildID]; !ok || s+o.FileSize < cur {
+				size[o.BuildID] = s + o.FileSize
+				via[o.BuildID] = o
+				changed = true
+			}
+		}
+	}
+
+	if _, ok := via[toBuild]; !ok {
+		return nil
+	}
+
+	var chain []OTA
+	for build := toBuild; build != fromBuild; build = via[build].PrerequisiteBuildID {
+		chain = append([]OTA{via[build]}, chain...)
+	}
+
+	return chain
+}
+
+// UpdateDownload describes the artifacts downloaded by DownloadUpdate
+type UpdateDownload struct {
+	Path UpgradePath
+	// Files are the downloaded files, for OTA updates in the order they must be applied
+	Files []string
+}
+
+// DownloadUpdate downloads what is needed to update a device between builds using the DefaultClient
+func DownloadUpdate(ctx context.Context, identifier, fromBuild, toBuild, destDir string) (*UpdateDownload, error) {
+	return DefaultClient().DownloadUpdate(ctx, identifier, fromBuild, toBuild, destDir)
+}
+
+// DownloadUpdate downloads what is needed to update a device from one build to another into destDir
+//
+// The smallest chain of delta OTAs is preferred when one exists, otherwise the full IPSW is downloaded.
+// The returned UpdateDownload reports which path was taken and the downloaded files so callers know how to apply them;
+// a device already on toBuild gets an empty OTA chain.
+func (c *Client) DownloadUpdate(ctx context.Context, identifier, fromBuild, toBuild, destDir string) (*UpdateDownload, error) {
+	if fromBuild == toBuild {
+		return &UpdateDownload{Path: UpgradePathOTA}, nil
+	}
+
+	otas, err := c.GetDeviceOTAs(identifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s OTAs: %w", identifier, err)
+	}
+
+	if chain := otaChain(otas, fromBuild, toBuild); chain != nil {
+		dl := &UpdateDownload{Path: UpgradePathOTA}
+		for _, o := range chain {
+			dest := filepath.Join(destDir, path.Base(o.URL))
+			if err := c.DownloadOTA(ctx, o, dest); err != nil {
+				return dl, fmt.Errorf("failed to download OTA %s → %s: %w", o.PrerequisiteBuildID, o.BuildID, err)
+			}
+			dl.Files = append(dl.Files, dest)
+		}
+		return dl, nil
+	}
+
+	i, err := c.GetIPSW(identifier, toBuild)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s IPSW for build %s: %w", identifier, toBuild, err)
+	}
+
+	dest := filepath.Join(destDir, path.Base(i.URL))
+	if err := c.DownloadIPSW(ctx, i, dest); err != nil {
+		return nil, fmt.Errorf("failed to download IPSW %s: %w", i, err)
+	}
+
+	return &UpdateDownload{Path: UpgradePathFullRestore, Files: []string{dest}}, nil
+}
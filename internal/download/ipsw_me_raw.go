@@ -0,0 +1,63 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// ErrRawCaptureDisabled is returned by the *Raw methods when the client was not created with WithRawCapture
+var ErrRawCaptureDisabled = errors.New("raw capture is disabled, create the client with WithRawCapture")
+
+// getRaw fetches path and decodes it into v returning a copy of the original JSON
+func (c *Client) getRaw(path string, v any) (json.RawMessage, error) {
+	if !c.rawCapture {
+		return nil, ErrRawCaptureDisabled
+	}
+
+	body, err := c.fetch(context.Background(), path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEmpty(path, body); err != nil {
+		return nil, err
+	}
+	if err := checkShape(path, body, v); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return nil, err
+	}
+
+	// the body may be shared with the cache so hand out a copy
+	return json.RawMessage(bytes.Clone(body)), nil
+}
+
+// GetDeviceRaw returns a device from its identifier along with the original JSON
+// so fields not yet modeled by Device can be accessed
+func (c *Client) GetDeviceRaw(identifier string) (Device, json.RawMessage, error) {
+	var d Device
+	raw, err := c.getRaw("device/"+NormalizeIdentifier(identifier), &d)
+	return d, raw, err
+}
+
+// GetAllDevicesRaw returns a list of all devices along with the original JSON
+//
+// The devices are deduplicated and sorted like GetAllDevices, the JSON is left as the API sent it.
+func (c *Client) GetAllDevicesRaw() ([]Device, json.RawMessage, error) {
+	var devices []Device
+	raw, err := c.getRaw("devices", &devices)
+	if err == nil {
+		devices = c.tidyDevices(devices)
+	}
+	return devices, raw, err
+}
+
+// GetReleasesRaw returns all iOS releases along with the original JSON
+func (c *Client) GetReleasesRaw() ([]Release, json.RawMessage, error) {
+	var releases []Release
+	raw, err := c.getRaw("releases", &releases)
+	return releases, raw, err
+}
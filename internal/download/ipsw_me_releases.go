@@ -0,0 +1,358 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ReleaseType is the channel a release was published on
+type ReleaseType int
+
+const (
+	// ReleaseTypeGA is a general availability release (neither beta nor RC)
+	ReleaseTypeGA ReleaseType = iota
+	// ReleaseTypeBeta is a beta release
+	ReleaseTypeBeta
+	// ReleaseTypeRC is a release candidate
+	ReleaseTypeRC
+)
+
+func (t ReleaseType) String() string {
+	switch t {
+	case ReleaseTypeGA:
+		return "ga"
+	case ReleaseTypeBeta:
+		return "beta"
+	case ReleaseTypeRC:
+		return "rc"
+	default:
+		return fmt.Sprintf("ReleaseType(%d)", int(t))
+	}
+}
+
+// Type returns the channel the release was published on
+func (r Release) Type() ReleaseType {
+	switch {
+	case r.Beta:
+		return ReleaseTypeBeta
+	case r.RC:
+		return ReleaseTypeRC
+	default:
+		return ReleaseTypeGA
+	}
+}
+
+// Age returns how long ago the release was published according to the DefaultClient's clock (see WithClock),
+// or 0 if its release date is unknown
+func (r Release) Age() time.Duration {
+	return age(r.Released)
+}
+
+// GetSignedReleases returns all iOS releases that are flagged as signed
+func GetSignedReleases() ([]Release, error) {
+	return DefaultClient().GetSignedReleases()
+}
+
+// GetSignedReleases returns all iOS releases that are flagged as signed
+//
+// NOTE: signing is per-device, a release's Signed flag is only a coarse aggregate
+// across every device the release applies to. Use GetSigningStatus to check a specific device.
+func (c *Client) GetSignedReleases() ([]Release, error) {
+	releases, err := c.GetReleases()
+	if err != nil {
+		return nil, err
+	}
+	return FilterSignedReleases(releases), nil
+}
+
+// FilterSignedReleases returns the releases that are flagged as signed
+//
+// NOTE: a release's Signed flag is a coarse aggregate across devices, see GetSigningStatus
+func FilterSignedReleases(releases []Release) []Release {
+	signed := []Release{}
+	for _, r := range releases {
+		if r.Signed {
+			signed = append(signed, r)
+		}
+	}
+	return signed
+}
+
+// FilterReleasesByType returns the releases of the given type
+func FilterReleasesByType(releases []Release, typ ReleaseType) []Release {
+	filtered := []Release{}
+	for _, r := range releases {
+		if r.Type() == typ {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+// SortReleasesByDate sorts releases in place by their release date
+func SortReleasesByDate(releases []Release, descending bool) {
+	slices.SortStableFunc(releases, func(a, b Release) int {
+		if descending {
+			return b.Released.Compare(a.Released)
+		}
+		return a.Released.Compare(b.Released)
+	})
+}
+
+// GetBetaReleases returns all beta releases in the API's order
+func GetBetaReleases() ([]Release, error) {
+	return DefaultClient().GetBetaReleases()
+}
+
+// GetBetaReleases returns all beta releases in the API's order
+func (c *Client) GetBetaReleases() ([]Release, error) {
+	releases, err := c.GetReleases()
+	if err != nil {
+		return nil, err
+	}
+	return FilterReleasesByType(releases, ReleaseTypeBeta), nil
+}
+
+// GetRCReleases returns all release candidates in the API's order
+func GetRCReleases() ([]Release, error) {
+	return DefaultClient().GetRCReleases()
+}
+
+// GetRCReleases returns all release candidates in the API's order
+func (c *Client) GetRCReleases() ([]Release, error) {
+	releases, err := c.GetReleases()
+	if err != nil {
+		return nil, err
+	}
+	return FilterReleasesByType(releases, ReleaseTypeRC), nil
+}
+
+// GetStableReleases returns all GA (non-beta, non-RC) releases sorted newest-first
+func GetStableReleases() ([]Release, error) {
+	return DefaultClient().GetStableReleases()
+}
+
+// GetStableReleases returns all GA (non-beta, non-RC) releases sorted newest-first
+func (c *Client) GetStableReleases() ([]Release, error) {
+	releases, err := c.GetReleases()
+	if err != nil {
+		return nil, err
+	}
+	stable := FilterReleasesByType(releases, ReleaseTypeGA)
+	SortReleasesByDate(stable, true)
+	return stable, nil
+}
+
+// GetReleasesForDevice returns the releases that apply to a device using the DefaultClient
+func GetReleasesForDevice(identifier string, opts ...ClientOption) ([]Release, error) {
+	return DefaultClient().GetReleasesForDevice(identifier, opts...)
+}
+
+// GetReleasesForDevice returns the releases that apply to a device in the API's order
+//
+// The feed's device IDs are sometimes board configs (e.g. "d83ap") rather than identifiers,
+// so they are matched case-insensitively and a board config can be passed as identifier.
+func (c *Client) GetReleasesForDevice(identifier string, opts ...ClientOption) ([]Release, error) {
+	releases, err := c.GetReleases(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := []Release{}
+	for _, r := range releases {
+		if slices.ContainsFunc(r.DeviceIDs, func(id string) bool { return strings.EqualFold(id, identifier) }) {
+			matching = append(matching, r)
+		}
+	}
+
+	return matching, nil
+}
+
+// GetReleasesGroupedByVersion returns all releases grouped by version using the DefaultClient
+func GetReleasesGroupedByVersion() (map[string][]Release, error) {
+	return DefaultClient().GetReleasesGroupedByVersion()
+}
+
+// GetReleasesGroupedByVersion returns all releases keyed by version with each group's releases
+// (beta 1..N, RC, GA) sorted oldest-first by release date and identical entries removed
+func (c *Client) GetReleasesGroupedByVersion() (map[string][]Release, error) {
+	releases, err := c.GetReleases()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string][]Release)
+	for _, r := range releases {
+		if slices.ContainsFunc(groups[r.Version], r.equal) {
+			continue
+		}
+		groups[r.Version] = append(groups[r.Version], r)
+	}
+	for _, group := range groups {
+		SortReleasesByDate(group, false)
+	}
+
+	return groups, nil
+}
+
+func (r Release) equal(o Release) bool {
+	return r.Version == o.Version &&
+		r.BuildID == o.BuildID &&
+		r.Released.Equal(o.Released) &&
+		r.Beta == o.Beta &&
+		r.RC == o.RC &&
+		r.Signed == o.Signed &&
+		slices.Equal(r.DeviceIDs, o.DeviceIDs)
+}
+
+// ReleasesDelta returns the releases whose build ID is not in known
+//
+// Nothing is updated server-side, callers add the returned build IDs to known themselves
+// which makes this the building block for efficiently polling for new releases.
+func (c *Client) ReleasesDelta(ctx context.Context, known map[string]bool) ([]Release, error) {
+	releases, err := c.getReleases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	delta := []Release{}
+	for _, r := range releases {
+		if !known[r.BuildID] {
+			delta = append(delta, r)
+		}
+	}
+
+	return delta, nil
+}
+
+// ReleasesSinceBuild returns the releases newer than a build using the DefaultClient
+func ReleasesSinceBuild(buildID string) ([]Release, error) {
+	return DefaultClient().ReleasesSinceBuild(buildID)
+}
+
+// ReleasesSinceBuild returns the releases published after the build, as dated by the releases feed,
+// sorted oldest-first to catch up on what was released since
+func (c *Client) ReleasesSinceBuild(buildID string) ([]Release, error) {
+	releases, err := c.GetReleases()
+	if err != nil {
+		return nil, err
+	}
+
+	idx := slices.IndexFunc(releases, func(r Release) bool { return r.BuildID == buildID })
+	if idx < 0 {
+		return nil, fmt.Errorf("%w: %s is not in the ipsw.me releases feed", ErrBuildNotFound, buildID)
+	}
+	since := releases[idx].Released
+
+	newer := []Release{}
+	for _, r := range releases {
+		if r.Released.After(since) {
+			newer = append(newer, r)
+		}
+	}
+	SortReleasesByDate(newer, false)
+
+	return newer, nil
+}
+
+// BuildInfo is what is known about a build ID
+type BuildInfo struct {
+	BuildID     string
+	Version     string
+	Identifiers []string
+	Signed      bool
+}
+
+// GetBuildInfo returns a build's version, devices and signing status using the DefaultClient
+func GetBuildInfo(buildID string) (BuildInfo, error) {
+	return DefaultClient().GetBuildInfo(buildID)
+}
+
+// GetBuildInfo returns a build's version, the devices it was released for and whether it is currently signed
+//
+// The releases feed is used when it lists the build (a single request), otherwise this falls back
+// to GetIPSWsForBuild which scans the device catalog. A build is reported signed if it is signed for any device.
+func (c *Client) GetBuildInfo(buildID string) (BuildInfo, error) {
+	releases, err := c.GetReleases()
+	if err != nil {
+		return BuildInfo{}, fmt.Errorf("failed to get releases from ipsw.me API: %v", err)
+	}
+
+	for _, r := range releases {
+		if r.BuildID == buildID && r.Version != "" {
+			return BuildInfo{
+				BuildID:     buildID,
+				Version:     r.Version,
+				Identifiers: slices.Clone(r.DeviceIDs),
+				Signed:      r.Signed,
+			}, nil
+		}
+	}
+
+	ipsws, err := c.GetIPSWsForBuild(buildID)
+	if err != nil {
+		return BuildInfo{}, err
+	}
+	if len(ipsws) == 0 {
+		return BuildInfo{}, fmt.Errorf("build %s did not match any IPSW in the ipsw.me API", buildID)
+	}
+
+	info := BuildInfo{BuildID: buildID, Version: ipsws[0].Version}
+	for _, i := range ipsws {
+		info.Identifiers = append(info.Identifiers, i.Identifier)
+		info.Signed = info.Signed || i.Signed
+	}
+	slices.Sort(info.Identifiers)
+
+	return info, nil
+}
+
+// ReleaseWithNames is a Release with the marketing names of its devices
+type ReleaseWithNames struct {
+	Release
+	// DeviceNames parallels DeviceIDs, identifiers not in the device catalog are reported as is
+	DeviceNames []string
+}
+
+// GetReleasesWithDeviceNames returns all releases with their device names using the DefaultClient
+func GetReleasesWithDeviceNames(ctx context.Context) ([]ReleaseWithNames, error) {
+	return DefaultClient().GetReleasesWithDeviceNames(ctx)
+}
+
+// GetReleasesWithDeviceNames returns all releases with the marketing names of their devices
+// resolved against the device catalog, which is fetched once (and cached with WithCache)
+func (c *Client) GetReleasesWithDeviceNames(ctx context.Context) ([]ReleaseWithNames, error) {
+	releases, err := c.getReleases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := c.getAllDevices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device list: %w", err)
+	}
+
+	names := make(map[string]string, len(devices))
+	for _, d := range devices {
+		if d.Name != "" {
+			names[d.Identifier] = d.Name
+		}
+	}
+
+	named := make([]ReleaseWithNames, 0, len(releases))
+	for _, r := range releases {
+		rn := ReleaseWithNames{Release: r, DeviceNames: make([]string, len(r.DeviceIDs))}
+		for idx, id := range r.DeviceIDs {
+			if name, ok := names[id]; ok {
+				rn.DeviceNames[idx] = name
+			} else {
+				rn.DeviceNames[idx] = id
+			}
+		}
+		named = append(named, rn)
+	}
+
+	return named, nil
+}
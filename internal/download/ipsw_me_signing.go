@@ -0,0 +1,204 @@
+package download
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SigningWindow estimates when signing of a device's build opened and closed using the DefaultClient
+func SigningWindow(identifier, buildID string) (opened time.Time, closed time.Time, stillSigned bool, err error) {
+	return DefaultClient().SigningWindow(identifier, buildID)
+}
+
+// SigningWindow estimates when Apple started and stopped signing a device's build
+//
+// The API doesn't expose when signing actually changed so this is a heuristic:
+//   - opened is the build's release date (or its upload date if the release date is unknown)
+//   - if the build is still signed, closed is the zero time and stillSigned is true
+//   - otherwise closed is the release date of the device's next build, as Apple usually stops
+//     signing a build shortly after its successor ships; closed is zero if there is no later build
+func (c *Client) SigningWindow(identifier, buildID string) (opened time.Time, closed time.Time, stillSigned bool, err error) {
+	ipsws, err := c.GetDeviceIPSWs(identifier)
+	if err != nil {
+		return opened, closed, false, err
+	}
+
+	var target *IPSW
+	for idx := range ipsws {
+		if ipsws[idx].BuildID == buildID {
+			target = &ipsws[idx]
+			break
+		}
+	}
+	if target == nil {
+		return opened, closed, false, fmt.Errorf("%w: %s for device %s", ErrBuildNotFound, buildID, identifier)
+	}
+
+	opened = target.ReleaseDate
+	if opened.IsZero() {
+		opened = target.UploadDate
+	}
+
+	if target.Signed {
+		return opened, closed, true, nil
+	}
+
+	for _, i := range ipsws {
+		if i.ReleaseDate.After(opened) && (closed.IsZero() || i.ReleaseDate.Before(closed)) {
+			closed = i.ReleaseDate
+		}
+	}
+
+	return opened, closed, false, nil
+}
+
+// GetCommonSignedVersion returns the newest version currently signed for all the devices using the DefaultClient
+func GetCommonSignedVersion(ctx context.Context, identifiers []string) (string, error) {
+	return DefaultClient().GetCommonSignedVersion(ctx, identifiers)
+}
+
+// GetCommonSignedVersion returns the newest version that is currently signed for every one of the devices
+//
+// Versions are ordered with CompareVersions so ones ParseVersion rejects are still considered.
+func (c *Client) GetCommonSignedVersion(ctx context.Context, identifiers []string) (string, error) {
+	if len(identifiers) == 0 {
+		return "", fmt.Errorf("no devices given")
+	}
+
+	devices := make([]Device, len(identifiers))
+	for idx, id := range identifiers {
+		devices[idx].Identifier = id
+	}
+	if err := c.HydrateFirmwares(ctx, devices, c.maxConcurrency); err != nil {
+		return "", err
+	}
+
+	var common map[string]bool
+	for _, d := range devices {
+		signed := make(map[string]bool)
+		for _, i := range d.Firmwares {
+			if i.Signed && (common == nil || common[i.Version]) {
+				signed[i.Version] = true
+			}
+		}
+		common = signed
+	}
+
+	var newest string
+	for v := range common {
+		// break ties between equal versions (e.g. 16.3 and 16.3.0) by string so the result is stable
+		if newest == "" || cmp.Or(CompareVersions(newest, v), strings.Compare(newest, v)) < 0 {
+			newest = v
+		}
+	}
+	if newest == "" {
+		return "", fmt.Errorf("no version is currently signed for all of %s", strings.Join(identifiers, ", "))
+	}
+
+	return newest, nil
+}
+
+// SigningEvent is a change of a device build's signing status observed between two snapshots
+type SigningEvent struct {
+	BuildID    string
+	Identifier string
+	Signed     bool
+	// At is the index of the snapshot the new status was first seen in
+	At int
+}
+
+// SigningHistory returns the timeline of signing status changes across an ordered series of
+// firmware snapshots (e.g. periodic GetDeviceIPSWs captures), keyed by identifier and build ID
+//
+// An event is emitted when a build's status differs from the last snapshot it appeared in, builds
+// missing from a snapshot keep their previous status. Events are ordered by At, then identifier and build ID.
+func SigningHistory(snapshots [][]IPSW) []SigningEvent {
+	type key struct{ identifier, buildID string }
+
+	events := []SigningEvent{}
+	last := make(map[key]bool)
+	for at, snapshot := range snapshots {
+		var changed []SigningEvent
+		for _, i := range snapshot {
+			k := key{i.Identifier, i.BuildID}
+			if signed, ok := last[k]; ok && signed != i.Signed {
+				changed = append(changed, SigningEvent{BuildID: i.BuildID, Identifier: i.Identifier, Signed: i.Signed, At: at})
+			}
+			last[k] = i.Signed
+		}
+		slices.SortFunc(changed, func(a, b SigningEvent) int {
+			return cmp.Or(cmp.Compare(a.Identifier, b.Identifier), cmp.Compare(a.BuildID, b.BuildID))
+		})
+		events = append(events, changed...)
+	}
+
+	return events
+}
+
+// PredictSigningDrop returns the device's signed builds likely to stop being signed soon using the DefaultClient
+func PredictSigningDrop(identifier string) ([]IPSW, error) {
+	return DefaultClient().PredictSigningDrop(identifier)
+}
+
+// PredictSigningDrop returns the device's currently signed builds that are older than its newest
+// signed version, oldest first, which are the ones worth downloading before signing closes
+//
+// This is a heuristic: Apple usually keeps signing only the latest one or two versions and stops
+// signing the older ones shortly after a new release, but there is no announced schedule.
+// Builds whose version can't be parsed are never flagged.
+func (c *Client) PredictSigningDrop(identifier string) ([]IPSW, error) {
+	ipsws, err := c.GetDeviceIPSWs(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	type signedBuild struct {
+		ipsw    IPSW
+		version Version
+	}
+	var signed []signedBuild
+	for _, i := range ipsws {
+		if !i.Signed {
+			continue
+		}
+		v, err := ParseVersion(i.Version)
+		if err != nil {
+			continue
+		}
+		signed = append(signed, signedBuild{i, v})
+	}
+	if len(signed) == 0 {
+		return []IPSW{}, nil
+	}
+
+	newest := signed[0].version
+	for _, s := range signed[1:] {
+		if newest.Less(s.version) {
+			newest = s.version
+		}
+	}
+
+	slices.SortStableFunc(signed, func(a, b signedBuild) int {
+		switch {
+		case a.version.Less(b.version):
+			return -1
+		case b.version.Less(a.version):
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	likelyToClose := []IPSW{}
+	for _, s := range signed {
+		if s.version.Less(newest) {
+			likelyToClose = append(likelyToClose, s.ipsw)
+		}
+	}
+
+	return likelyToClose, nil
+}
@@ -0,0 +1,144 @@
+package download
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// DeviceSortKey is the key used to sort devices
+type DeviceSortKey int
+
+const (
+	// SortByIdentifier sorts devices by identifier
+	SortByIdentifier DeviceSortKey = iota
+	// SortByName sorts devices by name and then identifier
+	SortByName
+	// SortByPlatform sorts devices by platform and then identifier
+	SortByPlatform
+)
+
+// SortDevices sorts devices in place by the given key
+func SortDevices(devices []Device, key DeviceSortKey) {
+	slices.SortStableFunc(devices, func(a, b Device) int {
+		switch key {
+		case SortByName:
+			if c := cmp.Compare(a.Name, b.Name); c != 0 {
+				return c
+			}
+		case SortByPlatform:
+			if c := cmp.Compare(a.Platform, b.Platform); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(a.Identifier, b.Identifier)
+	})
+}
+
+// SortIPSWsByReleaseDate sorts IPSWs in place by their release date, equal dates keep their input order
+func SortIPSWsByReleaseDate(ipsws []IPSW, descending bool) {
+	slices.SortStableFunc(ipsws, func(a, b IPSW) int {
+		if descending {
+			return b.ReleaseDate.Compare(a.ReleaseDate)
+		}
+		return a.ReleaseDate.Compare(b.ReleaseDate)
+	})
+}
+
+// SortIPSWsByVersion sorts IPSWs in place by their version compared numerically (so 9.0 < 10.0),
+// equal versions keep their input order and versions that don't parse sort as the oldest
+func SortIPSWsByVersion(ipsws []IPSW, descending bool) {
+	versions := make(map[string]Version, len(ipsws))
+	for _, i := range ipsws {
+		if _, ok := versions[i.Version]; !ok {
+			versions[i.Version], _ = ParseVersion(i.Version)
+		}
+	}
+
+	slices.SortStableFunc(ipsws, func(a, b IPSW) int {
+		if descending {
+			a, b = b, a
+		}
+		return versions[a.Version].Compare(versions[b.Version])
+	})
+}
+
+// GetRecentIPSWs returns a device's newest IPSWs using the DefaultClient
+func GetRecentIPSWs(identifier string, limit int) ([]IPSW, error) {
+	return DefaultClient().GetRecentIPSWs(identifier, limit)
+}
+
+// GetRecentIPSWs returns a device's limit newest IPSWs by release date (all of them if limit <= 0)
+func (c *Client) GetRecentIPSWs(identifier string, limit int) ([]IPSW, error) {
+	ipsws, err := c.GetDeviceIPSWs(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	SortIPSWsByReleaseDate(ipsws, true)
+	if limit > 0 && len(ipsws) > limit {
+		ipsws = ipsws[:limit]
+	}
+
+	return ipsws, nil
+}
+
+// GetLatestIPSW returns a device's newest IPSW using the DefaultClient
+func GetLatestIPSW(identifier string, opts ...ClientOption) (IPSW, error) {
+	return DefaultClient().GetLatestIPSW(identifier, opts...)
+}
+
+// GetLatestIPSW returns a device's newest IPSW by release date, or its newest signed IPSW
+// when created (or called) with WithPreferSigned and any of its IPSWs are signed
+func (c *Client) GetLatestIPSW(identifier string, opts ...ClientOption) (IPSW, error) {
+	c = c.with(opts)
+	ipsws, err := c.GetRecentIPSWs(identifier, 0)
+	if err != nil {
+		return IPSW{}, err
+	}
+	if len(ipsws) == 0 {
+		return IPSW{}, fmt.Errorf("no firmwares found for device %s", identifier)
+	}
+
+	if c.preferSigned {
+		if idx := slices.IndexFunc(ipsws, func(i IPSW) bool { return i.Signed }); idx >= 0 {
+			return ipsws[idx], nil
+		}
+	}
+
+	return ipsws[0], nil
+}
+
+// GetLatestBuildID returns the build ID of a device's newest IPSW using the DefaultClient
+func GetLatestBuildID(identifier string, opts ...ClientOption) (string, error) {
+	return DefaultClient().GetLatestBuildID(identifier, opts...)
+}
+
+// GetLatestBuildID returns the build ID of a device's newest IPSW, see GetLatestIPSW
+func (c *Client) GetLatestBuildID(identifier string, opts ...ClientOption) (string, error) {
+	i, err := c.GetLatestIPSW(identifier, opts...)
+	if err != nil {
+		return "", err
+	}
+	return i.BuildID, nil
+}
+
+// GetLatestSignedIPSW returns a device's newest signed IPSW using the DefaultClient
+func GetLatestSignedIPSW(identifier string, opts ...ClientOption) (IPSW, error) {
+	return DefaultClient().GetLatestSignedIPSW(identifier, opts...)
+}
+
+// GetLatestSignedIPSW returns a device's newest signed IPSW by release date, or ErrNoSignedFirmware
+// if Apple isn't signing any of its IPSWs
+func (c *Client) GetLatestSignedIPSW(identifier string, opts ...ClientOption) (IPSW, error) {
+	ipsws, err := c.GetSignedIPSWs(identifier, opts...)
+	if err != nil {
+		return IPSW{}, err
+	}
+	if len(ipsws) == 0 {
+		return IPSW{}, fmt.Errorf("%w: %s", ErrNoSignedFirmware, identifier)
+	}
+
+	SortIPSWsByReleaseDate(ipsws, true)
+	return ipsws[0], nil
+}
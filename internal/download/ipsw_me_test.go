@@ -0,0 +1,2427 @@
+package download
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+)
+
+// newTestClient returns a Client talking to a test server serving handler
+func newTestClient(t *testing.T, handler http.HandlerFunc, opts ...ClientOption) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return NewClient(append([]ClientOption{WithHTTPClient(srv.Client()), WithBaseURL(srv.URL)}, opts...)...)
+}
+
+func TestDeviceString(t *testing.T) {
+	tests := []struct {
+		name   string
+		device Device
+		want   string
+	}{
+		{"full", Device{Name: "iPhone 15 Pro", Identifier: "iPhone16,1"}, "iPhone 15 Pro (iPhone16,1)"},
+		{"identifier only", Device{Identifier: "iPhone16,1"}, "iPhone16,1"},
+		{"name only", Device{Name: "iPhone 15 Pro"}, "iPhone 15 Pro"},
+		{"zero", Device{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.device.String(); got != tt.want {
+				t.Errorf("Device.String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPSWString(t *testing.T) {
+	tests := []struct {
+		name string
+		ipsw IPSW
+		want string
+	}{
+		{"signed", IPSW{Identifier: "iPhone16,1", Version: "17.2", BuildID: "21C62", Signed: true}, "iPhone16,1 17.2 (21C62) [signed]"},
+		{"unsigned", IPSW{Identifier: "iPhone16,1", Version: "17.1", BuildID: "21B80"}, "iPhone16,1 17.1 (21B80)"},
+		{"no build", IPSW{Identifier: "iPhone16,1", Version: "17.2"}, "iPhone16,1 17.2"},
+		{"zero", IPSW{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ipsw.String(); got != tt.want {
+				t.Errorf("IPSW.String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPSWFileSizeUnmarshal(t *testing.T) {
+	var i IPSW
+	if err := json.Unmarshal([]byte(`{"identifier":"iPhone16,1","filesize":6442450944}`), &i); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if want := int64(6442450944); i.FileSize != want {
+		t.Errorf("IPSW.FileSize = %d, want %d", i.FileSize, want)
+	}
+}
+
+func TestIPSWIsDownloadable(t *testing.T) {
+	tests := []struct {
+		name string
+		ipsw IPSW
+		want bool
+	}{
+		{"downloadable", IPSW{URL: "https://updates.cdn-apple.com/test.ipsw", FileSize: 1024}, true},
+		{"zero url", IPSW{FileSize: 1024}, false},
+		{"zero size", IPSW{URL: "https://updates.cdn-apple.com/test.ipsw"}, false},
+		{"zero", IPSW{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ipsw.IsDownloadable(); got != tt.want {
+				t.Errorf("IPSW.IsDownloadable() = %v, want %v", got, tt.want)
+			}
+			if tt.want {
+				return
+			}
+			dest := filepath.Join(t.TempDir(), "test.ipsw")
+			if err := DownloadIPSW(t.Context(), tt.ipsw, dest); !errors.Is(err, ErrNotDownloadable) {
+				t.Errorf("DownloadIPSW() error = %v, want %v", err, ErrNotDownloadable)
+			}
+			if _, err := os.Stat(dest); !os.IsNotExist(err) {
+				t.Errorf("DownloadIPSW() created %s", dest)
+			}
+		})
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Version
+		wantErr bool
+	}{
+		{"17", Version{Major: 17}, false},
+		{"17.2", Version{Major: 17, Minor: 2}, false},
+		{"17.2.1", Version{Major: 17, Minor: 2, Patch: 1}, false},
+		{"17.0 beta 3", Version{Major: 17, Beta: 3}, false},
+		{"17.0 Beta", Version{Major: 17, Beta: 1}, false},
+		{"", Version{}, true},
+		{"seventeen", Version{}, true},
+		{"17.a", Version{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseVersion(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseVersion() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"9.0", "10.0", true},
+		{"10.0", "9.3.5", false},
+		{"17.2", "17.2.1", true},
+		{"17.0 beta 3", "17.0", true},
+		{"17.0", "17.0 beta 3", false},
+		{"17.0 beta 2", "17.0 beta 3", true},
+		{"17.2", "17.2", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" < "+tt.b, func(t *testing.T) {
+			a, _ := ParseVersion(tt.a)
+			b, _ := ParseVersion(tt.b)
+			if got := a.Less(b); got != tt.want {
+				t.Errorf("Version.Less() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"10.0", "9.3.5", 1},
+		{"9.3.5", "10.0", -1},
+		{"16.3", "16.3.0", 0},
+		{"16.3", "16.4", -1},
+		{"16.3.1", "16.3.2", -1},
+		{"17", "17.0.0", 0},
+		{"16.3 (20D47)", "16.3", 0},
+		{"16.3.1a", "16.3.1", 0},
+		{"17.0 beta 2", "17.0", -1},
+		{"unknown", "1.0", -1},
+		{"unknown", "unknown", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			if got := CompareVersions(tt.a, tt.b); got != tt.want {
+				t.Errorf("CompareVersions() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetDefaultClientConcurrent(t *testing.T) {
+	prev := DefaultClient()
+	t.Cleanup(func() { SetDefaultClient(prev) })
+
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"version":"17.2","buildid":"21C62"}]`))
+	})
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				SetDefaultClient(c)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				if DefaultClient() == nil {
+					t.Error("DefaultClient() = nil")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	releases, err := GetReleases()
+	if err != nil {
+		t.Fatalf("GetReleases() error = %v", err)
+	}
+	if len(releases) != 1 || releases[0].BuildID != "21C62" {
+		t.Errorf("GetReleases() = %v, want the test double's release", releases)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		wantErr bool
+	}{
+		{"default does not retry 403", nil, true},
+		{"custom retries 403", func(status int, err error) bool {
+			return status == http.StatusForbidden || DefaultRetryPolicy(status, err)
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests == 1 {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				w.Write([]byte("ipsw"))
+			}))
+			defer srv.Close()
+
+			var policy RetryPolicy
+			if tt.policy != nil {
+				policy = func(status int, err error) bool {
+					if status >= 200 && status < 300 {
+						t.Errorf("retry policy called for status %d", status)
+					}
+					return tt.policy(status, err)
+				}
+			}
+			c := NewClient(WithHTTPClient(srv.Client()), WithDownloadRetry(3, time.Millisecond), WithRetryPolicy(policy))
+
+			dest := filepath.Join(t.TempDir(), "test.ipsw")
+			err := c.DownloadIPSW(t.Context(), IPSW{URL: srv.URL, FileSize: 4}, dest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DownloadIPSW() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if requests != 1 {
+					t.Errorf("DownloadIPSW() made %d requests, want 1", requests)
+				}
+				return
+			}
+			if data, _ := os.ReadFile(dest); string(data) != "ipsw" {
+				t.Errorf("downloaded %q, want %q", data, "ipsw")
+			}
+		})
+	}
+}
+
+func TestNormalizeIdentifier(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"iPhone15,2", "iPhone15,2"},
+		{"iphone15,2", "iPhone15,2"},
+		{"IPHONE15,2", "iPhone15,2"},
+		{"iPhone 15,2", "iPhone15,2"},
+		{"iPhone15 , 2", "iPhone15,2"},
+		{"  iphone15,2\n", "iPhone15,2"},
+		{"ipad13,18", "iPad13,18"},
+		{"iPad 13, 18", "iPad13,18"},
+		{"ipod9,1", "iPod9,1"},
+		{"watch6,1", "Watch6,1"},
+		{"WATCH 7,5", "Watch7,5"},
+		{"appletv11,1", "AppleTV11,1"},
+		{"Apple TV 11,1", "AppleTV11,1"},
+		{"audioaccessory5,1", "AudioAccessory5,1"},
+		{"AudioAccessory 1,1", "AudioAccessory1,1"},
+		{"Mac14,2", "Mac14,2"},
+		{"mac14,2", "Mac14,2"},
+		{"macbookpro18,1", "MacBookPro18,1"},
+		{"imac21,1", "iMac21,1"},
+		{"ibridge2,1", "iBridge2,1"},
+		{"VMA2MacOSAP", "VMA2MacOSAP"},
+		{"iphone", "iphone"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := NormalizeIdentifier(tt.in); got != tt.want {
+				t.Errorf("NormalizeIdentifier(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadIPSWConcurrentSameDest(t *testing.T) {
+	payload := []byte(strings.Repeat("ipsw", 1024))
+
+	var mu sync.Mutex
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		for chunk := range slices.Chunk(payload, 512) {
+			w.Write(chunk)
+			w.(http.Flusher).Flush()
+			time.Sleep(time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithHTTPClient(srv.Client()))
+	i := IPSW{URL: srv.URL, FileSize: int64(len(payload))}
+	dest := filepath.Join(t.TempDir(), "test.ipsw")
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for idx := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[idx] = c.DownloadIPSW(t.Context(), i, dest)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("DownloadIPSW() error = %v", err)
+		}
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, payload) {
+		t.Errorf("downloaded %d bytes, want the %d byte payload", len(data), len(payload))
+	}
+	if requests != 1 {
+		t.Errorf("server got %d requests, want 1", requests)
+	}
+}
+
+func TestDownloadIfMissingConcurrent(t *testing.T) {
+	payload := []byte(strings.Repeat("ipsw", 1024))
+	sha1sum := fmt.Sprintf("%x", sha1.Sum(payload))
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		for chunk := range slices.Chunk(payload, 512) {
+			w.Write(chunk)
+			w.(http.Flusher).Flush()
+			time.Sleep(time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithHTTPClient(srv.Client()))
+	i := IPSW{URL: srv.URL, FileSize: int64(len(payload)), SHA1: sha1sum}
+	dest := filepath.Join(t.TempDir(), "test.ipsw")
+
+	var wg sync.WaitGroup
+	var downloads atomic.Int32
+	errs := make([]error, 4)
+	for idx := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var downloaded bool
+			if idx%2 == 0 {
+				downloaded, errs[idx] = c.DownloadIfMissing(t.Context(), i, dest)
+			} else {
+				var res RepairResult
+				res, errs[idx] = c.VerifyAndRepair(t.Context(), i, dest)
+				downloaded = res != RepairNone
+			}
+			if downloaded {
+				downloads.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent download error = %v", err)
+		}
+	}
+	if n := downloads.Load(); n != 1 {
+		t.Errorf("%d calls reported downloading the file, want 1", n)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("server got %d requests, want 1", n)
+	}
+	if data, _ := os.ReadFile(dest); !bytes.Equal(data, payload) {
+		t.Errorf("downloaded %d bytes, want the %d byte payload", len(data), len(payload))
+	}
+}
+
+func TestDownloadCompletePart(t *testing.T) {
+	payload := []byte(strings.Repeat("ipsw", 1024))
+	sha1sum := fmt.Sprintf("%x", sha1.Sum(payload))
+
+	tests := []struct {
+		name         string
+		part         []byte
+		size         int64
+		wantRequests int
+		wantErr      error
+	}{
+		{"complete", payload, int64(len(payload)), 0, nil},
+		{"complete but corrupt", bytes.Repeat([]byte("x"), len(payload)), int64(len(payload)), 0, ErrChecksumMismatch},
+		{"416 with unknown size", payload, 0, 1, nil},
+		{"longer than the file", append(slices.Clone(payload), "trailing"...), int64(len(payload)), 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				http.ServeContent(w, r, "test.ipsw", time.Time{}, bytes.NewReader(payload))
+			}))
+			defer srv.Close()
+
+			dest := filepath.Join(t.TempDir(), "test.ipsw")
+			if err := os.WriteFile(dest+".part", tt.part, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			c := NewClient(WithHTTPClient(srv.Client()))
+			sums := checksums{}
+			if tt.size > 0 {
+				sums.sha1 = sha1sum
+			}
+			err := c.download(t.Context(), srv.URL, tt.size, sums, dest)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("download() error = %v, want %v", err, tt.wantErr)
+			}
+			if n := requests.Load(); n != int32(tt.wantRequests) {
+				t.Errorf("server got %d requests, want %d", n, tt.wantRequests)
+			}
+			if _, err := os.Stat(dest + ".part"); !os.IsNotExist(err) {
+				t.Errorf("the .part file was left behind (stat error = %v)", err)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if data, _ := os.ReadFile(dest); !bytes.Equal(data, payload) {
+				t.Errorf("downloaded %d bytes, want the %d byte payload", len(data), len(payload))
+			}
+		})
+	}
+}
+
+func TestDownloadIPSWExistingDest(t *testing.T) {
+	payload := []byte(strings.Repeat("ipsw", 1024))
+	sha1sum := fmt.Sprintf("%x", sha1.Sum(payload))
+
+	tests := []struct {
+		name         string
+		existing     []byte
+		sha1         string
+		wantRequests int32
+	}{
+		{"matching", payload, sha1sum, 0},
+		{"same size but corrupt", bytes.Repeat([]byte("x"), len(payload)), sha1sum, 1},
+		{"same size without checksum", bytes.Repeat([]byte("x"), len(payload)), "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.Write(payload)
+			}))
+			defer srv.Close()
+
+			dest := filepath.Join(t.TempDir(), "test.ipsw")
+			if err := os.WriteFile(dest, tt.existing, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			c := NewClient(WithHTTPClient(srv.Client()))
+			i := IPSW{URL: srv.URL, FileSize: int64(len(payload)), SHA1: tt.sha1}
+			if err := c.DownloadIPSW(t.Context(), i, dest); err != nil {
+				t.Fatalf("DownloadIPSW() error = %v", err)
+			}
+			if n := requests.Load(); n != tt.wantRequests {
+				t.Errorf("server got %d requests, want %d", n, tt.wantRequests)
+			}
+			want := tt.existing
+			if tt.wantRequests > 0 {
+				want = payload
+			}
+			if data, _ := os.ReadFile(dest); !bytes.Equal(data, want) {
+				t.Errorf("dest has %q, want %q", data[:8], want[:8])
+			}
+		})
+	}
+}
+
+func TestIsMac(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"Mac14,2", true},
+		{"mac14,2", true},
+		{"MacBookPro18,1", true},
+		{"iMac21,1", true},
+		{"Macmini9,1", true},
+		{"VMA2MacOSAP", true},
+		{"iPhone15,2", false},
+		{"iBridge2,1", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := IsMac(tt.in); got != tt.want {
+				t.Errorf("IsMac(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIPSWFilename(t *testing.T) {
+	tests := []struct {
+		name           string
+		wantIdentifier string
+		wantVersion    string
+		wantBuild      string
+		wantErr        bool
+	}{
+		{"iPhone12,8_16.3.1_20D67_Restore.ipsw", "iPhone12,8", "16.3.1", "20D67", false},
+		{"iPhone15,4,iPhone15,5_17.2_21C62_Restore.ipsw", "iPhone15,4,iPhone15,5", "17.2", "21C62", false},
+		{"UniversalMac_14.2_23C64_Restore.ipsw", "UniversalMac", "14.2", "23C64", false},
+		{"Mac14,2_13.0_22A5321d_Restore.ipsw", "Mac14,2", "13.0", "22A5321d", false},
+		{"firmware.ipsw", "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identifier, version, build, err := ParseIPSWFilename(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseIPSWFilename() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if identifier != tt.wantIdentifier || version != tt.wantVersion || build != tt.wantBuild {
+				t.Errorf("ParseIPSWFilename() = (%q, %q, %q), want (%q, %q, %q)", identifier, version, build, tt.wantIdentifier, tt.wantVersion, tt.wantBuild)
+			}
+		})
+	}
+}
+
+func TestDownloadIPSWChecksum(t *testing.T) {
+	payload := []byte(strings.Repeat("ipsw", 1024))
+	sha1sum := fmt.Sprintf("%x", sha1.Sum(payload))
+	md5sum := fmt.Sprintf("%x", md5.Sum(payload))
+
+	tests := []struct {
+		name    string
+		partial int
+		sha1    string
+		md5     string
+		wantErr error
+	}{
+		{"fresh", 0, sha1sum, md5sum, nil},
+		{"resumed", len(payload) / 3, sha1sum, md5sum, nil},
+		{"uppercase", 0, strings.ToUpper(sha1sum), "", nil},
+		{"sha1 mismatch", 0, strings.Repeat("0", 40), md5sum, ErrChecksumMismatch},
+		{"resumed md5 mismatch", len(payload) / 3, sha1sum, strings.Repeat("0", 32), ErrChecksumMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ranged bool
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ranged = r.Header.Get("Range") != ""
+				http.ServeContent(w, r, "test.ipsw", time.Time{}, bytes.NewReader(payload))
+			}))
+			defer srv.Close()
+
+			dest := filepath.Join(t.TempDir(), "test.ipsw")
+			if tt.partial > 0 {
+				if err := os.WriteFile(dest+".part", payload[:tt.partial], 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			c := NewClient(WithHTTPClient(srv.Client()))
+			i := IPSW{URL: srv.URL, FileSize: int64(len(payload)), SHA1: tt.sha1, MD5: tt.md5}
+			err := c.DownloadIPSW(t.Context(), i, dest)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DownloadIPSW() error = %v, want %v", err, tt.wantErr)
+			}
+			if ranged != (tt.partial > 0) {
+				t.Errorf("server got Range request = %v, want %v", ranged, tt.partial > 0)
+			}
+			if tt.wantErr != nil {
+				if _, err := os.Stat(dest + ".part"); !os.IsNotExist(err) {
+					t.Errorf("DownloadIPSW() kept the .part file of a corrupt download")
+				}
+				return
+			}
+			if data, _ := os.ReadFile(dest); !bytes.Equal(data, payload) {
+				t.Errorf("downloaded %d bytes, want the %d byte payload", len(data), len(payload))
+			}
+		})
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var requests int
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"identifier":"iPhone16,1"}]`))
+	}, WithCache(time.Minute), WithClock(func() time.Time { return now }))
+
+	for _, step := range []struct {
+		advance time.Duration
+		want    int
+	}{
+		{0, 1},
+		{59 * time.Second, 1},
+		{2 * time.Second, 2},
+	} {
+		now = now.Add(step.advance)
+		if _, err := c.GetAllDevices(); err != nil {
+			t.Fatalf("GetAllDevices() error = %v", err)
+		}
+		if requests != step.want {
+			t.Errorf("after %s server got %d requests, want %d", step.advance, requests, step.want)
+		}
+	}
+
+	c.ClearCache()
+	if _, err := c.GetAllDevices(); err != nil {
+		t.Fatalf("GetAllDevices() error = %v", err)
+	}
+	if requests != 3 {
+		t.Errorf("after ClearCache server got %d requests, want 3", requests)
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	var requests atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	}, WithCache(time.Hour), WithRetry(3, time.Millisecond))
+
+	if _, err := c.GetReleases(); err != nil {
+		t.Fatalf("GetReleases() error = %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+
+	if _, err := c.GetReleases(); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("GetReleases() after Close error = %v, want %v", err, ErrClientClosed)
+	}
+	if _, err := c.GetReleases(WithRetry(1, 0)); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("GetReleases() with options after Close error = %v, want %v", err, ErrClientClosed)
+	}
+	i := IPSW{URL: "http://example.com/test.ipsw", FileSize: 1}
+	if err := c.DownloadIPSW(t.Context(), i, filepath.Join(t.TempDir(), "test.ipsw")); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("DownloadIPSW() after Close error = %v, want %v", err, ErrClientClosed)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("server got %d requests, want only the one before Close", n)
+	}
+
+	feed := NewReleaseFeed(c, time.Millisecond)
+	select {
+	case <-feed.done:
+	case <-time.After(time.Second):
+		t.Error("ReleaseFeed kept polling a closed client")
+	}
+	feed.Close()
+}
+
+func TestGetJSONShape(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		call    func(c *Client) error
+		wantErr error
+	}{
+		{"devices array", `[{"identifier":"iPhone16,1"}]`, func(c *Client) error { _, err := c.GetAllDevices(); return err }, nil},
+		{"devices object", `{"identifier":"iPhone16,1"}`, func(c *Client) error { _, err := c.GetAllDevices(); return err }, ErrUnexpectedShape},
+		{"ipsws object", `{"message":"not found"}`, func(c *Client) error { _, err := c.GetAllIPSW("17.2"); return err }, ErrUnexpectedShape},
+		{"device object", `{"identifier":"iPhone16,1","firmwares":[]}`, func(c *Client) error { _, err := c.GetDevice("iPhone16,1"); return err }, nil},
+		{"device array", ` [{"identifier":"iPhone16,1"}]`, func(c *Client) error { _, err := c.GetDevice("iPhone16,1"); return err }, ErrUnexpectedShape},
+		{"device string", `"iPhone16,1"`, func(c *Client) error { _, err := c.GetDevice("iPhone16,1"); return err }, ErrUnexpectedShape},
+		{"null", `null`, func(c *Client) error { _, err := c.GetAllDevices(); return err }, ErrEmptyResponse},
+		{"empty", ``, func(c *Client) error { _, err := c.GetReleases(); return err }, ErrEmptyResponse},
+		{"whitespace", " \n", func(c *Client) error { _, err := c.GetReleases(); return err }, ErrEmptyResponse},
+		{"device without identifier", `{"name":""}`, func(c *Client) error { _, err := c.GetDevice("iPhone16,1"); return err }, ErrEmptyResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.body))
+			})
+			if err := tt.call(c); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteReleasesAtom(t *testing.T) {
+	released := time.Date(2023, 12, 11, 18, 0, 0, 0, time.UTC)
+	releases := []Release{
+		{Version: "17.2", BuildID: "21C62", Released: released, DeviceIDs: []string{"iPhone16,1", "iPhone16,2"}},
+		{Version: "17.3", BuildID: "21D5026f", Released: released.Add(24 * time.Hour), Beta: true},
+		{Version: "17.2 & <RC>", BuildID: "21C5054b", RC: true},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteReleasesAtom(&buf, releases); err != nil {
+		t.Fatalf("WriteReleasesAtom() error = %v", err)
+	}
+
+	var feed struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		ID      string   `xml:"id"`
+		Updated string   `xml:"updated"`
+		Entries []struct {
+			ID        string `xml:"id"`
+			Title     string `xml:"title"`
+			Published string `xml:"published"`
+			Category  struct {
+				Term string `xml:"term,attr"`
+			} `xml:"category"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &feed); err != nil {
+		t.Fatalf("xml.Unmarshal() error = %v\n%s", err, buf.String())
+	}
+
+	if feed.ID == "" {
+		t.Error("feed has no id")
+	}
+	if want := "2023-12-12T18:00:00Z"; feed.Updated != want {
+		t.Errorf("feed updated = %q, want %q", feed.Updated, want)
+	}
+	if len(feed.Entries) != len(releases) {
+		t.Fatalf("feed has %d entries, want %d", len(feed.Entries), len(releases))
+	}
+	want := []struct{ title, published, term string }{
+		{"17.2 (21C62)", "2023-12-11T18:00:00Z", "ga"},
+		{"17.3 (21D5026f)", "2023-12-12T18:00:00Z", "beta"},
+		{"17.2 & <RC> (21C5054b)", "1970-01-01T00:00:00Z", "rc"},
+	}
+	for idx, e := range feed.Entries {
+		if e.ID == "" {
+			t.Errorf("entry %d has no id", idx)
+		}
+		if e.Title != want[idx].title || e.Published != want[idx].published || e.Category.Term != want[idx].term {
+			t.Errorf("entry %d = (%q, %q, %q), want (%q, %q, %q)", idx, e.Title, e.Published, e.Category.Term, want[idx].title, want[idx].published, want[idx].term)
+		}
+	}
+}
+
+func TestDownloadIPSWProgressAbort(t *testing.T) {
+	payload := []byte(strings.Repeat("ipsw", 64*1024))
+	var ranged bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranged = r.Header.Get("Range") != ""
+		http.ServeContent(w, r, "test.ipsw", time.Time{}, bytes.NewReader(payload))
+	}))
+	defer srv.Close()
+
+	errStop := errors.New("stopped by user")
+	i := IPSW{URL: srv.URL, FileSize: int64(len(payload))}
+	dest := filepath.Join(t.TempDir(), "test.ipsw")
+
+	var calls int
+	c := NewClient(WithHTTPClient(srv.Client()), WithDownloadRetry(3, time.Millisecond), WithProgress(func(downloaded, total int64) error {
+		calls++
+		if total != int64(len(payload)) {
+			t.Errorf("progress total = %d, want %d", total, len(payload))
+		}
+		if downloaded > 0 {
+			return errStop
+		}
+		return nil
+	}))
+	if err := c.DownloadIPSW(t.Context(), i, dest); !errors.Is(err, errStop) {
+		t.Fatalf("DownloadIPSW() error = %v, want %v", err, errStop)
+	}
+	if calls != 1 {
+		t.Errorf("progress called %d times after aborting, want 1", calls)
+	}
+	if _, err := os.Stat(dest + ".part"); err != nil {
+		t.Fatalf("DownloadIPSW() didn't keep the .part file: %v", err)
+	}
+
+	if err := DownloadIPSW(t.Context(), i, dest, WithHTTPClient(srv.Client())); err != nil {
+		t.Fatalf("resumed DownloadIPSW() error = %v", err)
+	}
+	if !ranged {
+		t.Error("resumed DownloadIPSW() didn't send a Range request")
+	}
+	if data, _ := os.ReadFile(dest); !bytes.Equal(data, payload) {
+		t.Errorf("downloaded %d bytes, want the %d byte payload", len(data), len(payload))
+	}
+}
+
+func TestDedupeDevices(t *testing.T) {
+	tests := []struct {
+		name    string
+		devices []Device
+		want    []Device
+	}{
+		{
+			"no duplicates",
+			[]Device{{Identifier: "iPhone16,1", Name: "iPhone 15 Pro"}, {Identifier: "iPhone16,2", Name: "iPhone 15 Pro Max"}},
+			[]Device{{Identifier: "iPhone16,1", Name: "iPhone 15 Pro"}, {Identifier: "iPhone16,2", Name: "iPhone 15 Pro Max"}},
+		},
+		{
+			"prefer named",
+			[]Device{{Identifier: "iPhone16,1"}, {Identifier: "iPhone16,2"}, {Identifier: "iPhone16,1", Name: "iPhone 15 Pro"}},
+			[]Device{{Identifier: "iPhone16,1", Name: "iPhone 15 Pro"}, {Identifier: "iPhone16,2"}},
+		},
+		{
+			"conflicting metadata",
+			[]Device{
+				{Identifier: "iPhone16,1", Name: "iPhone 15 Pro"},
+				{Identifier: "iPhone16,1", Name: "iPhone 15 Pro (A)", BoardConfig: "D83AP"},
+				{Identifier: "iPhone16,1", Name: "iPhone 15 Pro (B)", BoardConfig: "D83AP"},
+			},
+			[]Device{{Identifier: "iPhone16,1", Name: "iPhone 15 Pro (A)", BoardConfig: "D83AP"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DedupeDevices(tt.devices)
+			if !slices.EqualFunc(got, tt.want, func(a, b Device) bool {
+				return a.Identifier == b.Identifier && a.Name == b.Name && a.BoardConfig == b.BoardConfig
+			}) {
+				t.Errorf("DedupeDevices() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAllDevicesRawDedupe(t *testing.T) {
+	body := `[{"identifier":"iPhone16,2"},{"identifier":"iPhone16,1"},{"identifier":"iPhone16,1","name":"iPhone 15 Pro"}]`
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}, WithRawCapture())
+
+	devices, raw, err := c.GetAllDevicesRaw()
+	if err != nil {
+		t.Fatalf("GetAllDevicesRaw() error = %v", err)
+	}
+	if len(devices) != 2 || devices[0].Identifier != "iPhone16,1" || devices[0].Name != "iPhone 15 Pro" {
+		t.Errorf("GetAllDevicesRaw() = %v, want the named iPhone16,1 then iPhone16,2", devices)
+	}
+	if string(raw) != body {
+		t.Errorf("GetAllDevicesRaw() raw = %s, want the original %s", raw, body)
+	}
+}
+
+func TestGetDevicesFromCatalog(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/devices" {
+			w.Write([]byte(`[{"identifier":"iPhone15,2"},{"identifier":"iPhone15,3"},{"identifier":"iPad14,1"}]`))
+			return
+		}
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(20 * time.Millisecond)
+		id := strings.TrimPrefix(r.URL.Path, "/device/")
+		fmt.Fprintf(w, `{"identifier":%q,"firmwares":[{"identifier":%q,"buildid":"20D47"}]}`, id, id)
+	}, WithMaxConcurrency(1))
+
+	got, err := c.GetDevicesFromCatalog([]string{"iphone15,2", "IPHONE 15,3", "iPhone99,1"}, true)
+	if err != nil {
+		t.Fatalf("GetDevicesFromCatalog() error = %v", err)
+	}
+	if len(got) != 2 || len(got["iPhone15,2"].Firmwares) != 1 || len(got["iPhone15,3"].Firmwares) != 1 {
+		t.Errorf("GetDevicesFromCatalog() = %v, want hydrated iPhone15,2 and iPhone15,3", got)
+	}
+	if p := peak.Load(); p != 1 {
+		t.Errorf("GetDevicesFromCatalog() made %d concurrent requests, want 1", p)
+	}
+}
+
+func TestWithHTTP2Disabled(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ClientOption
+		want bool
+	}{
+		{"default", nil, true},
+		{"disabled", []ClientOption{WithHTTP2Disabled()}, false},
+		{"disabled custom client", []ClientOption{WithHTTP2Disabled(), WithHTTPClient(&http.Client{Transport: &http.Transport{ForceAttemptHTTP2: true}})}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(tt.opts...)
+			tr, ok := c.transport()
+			if !ok {
+				t.Fatalf("client transport is %T, want *http.Transport", c.httpClient.Transport)
+			}
+			if http2 := !http2Disabled(tr); http2 != tt.want {
+				t.Errorf("HTTP/2 enabled = %v, want %v (ForceAttemptHTTP2 %v, TLSNextProto %v)", http2, tt.want, tr.ForceAttemptHTTP2, tr.TLSNextProto)
+			}
+		})
+	}
+	if tr := http.DefaultTransport.(*http.Transport); http2Disabled(tr) {
+		t.Error("WithHTTP2Disabled() modified http.DefaultTransport")
+	}
+}
+
+func TestWithMaxResponseBytes(t *testing.T) {
+	body := `[{"identifier":"iPhone16,1"}]`
+	tests := []struct {
+		name    string
+		limit   int64
+		wantErr error
+	}{
+		{"under", int64(len(body)) + 1, nil},
+		{"exact", int64(len(body)), nil},
+		{"over", int64(len(body)) - 1, ErrResponseTooLarge},
+		{"unlimited", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(body))
+			}, WithMaxResponseBytes(tt.limit))
+			if _, err := c.GetAllDevices(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetAllDevices() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		wantCalls int
+		wantErr   bool
+	}{
+		{"recovers from 503", []int{http.StatusServiceUnavailable, http.StatusBadGateway}, 3, false},
+		{"gives up", []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable}, 3, true},
+		{"no retry on 404", []int{http.StatusNotFound}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls <= len(tt.statuses) {
+					http.Error(w, "unavailable", tt.statuses[calls-1])
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`[{"identifier":"iPhone16,1"}]`))
+			}, WithRetry(3, time.Millisecond))
+			if _, err := c.GetAllDevices(); (err != nil) != tt.wantErr {
+				t.Errorf("GetAllDevices() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("got %d requests, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDownloadBuildManifest(t *testing.T) {
+	manifest := []byte(`<?xml version="1.0" encoding="UTF-8"?><plist version="1.0"><dict/></plist>`)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range map[string][]byte{
+		"BuildManifest.plist": manifest,
+		"kernelcache.release": bytes.Repeat([]byte("kernel"), 64*1024),
+	} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ipsw := buf.Bytes()
+
+	tests := []struct {
+		name   string
+		ranges bool
+	}{
+		{"ranges", true},
+		{"no ranges", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var served int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !tt.ranges {
+					w.Write(ipsw)
+					mu.Lock()
+					served += len(ipsw)
+					mu.Unlock()
+					return
+				}
+				cw := &countingWriter{ResponseWriter: w}
+				http.ServeContent(cw, r, "test.ipsw", time.Unix(1700000000, 0), bytes.NewReader(ipsw))
+				mu.Lock()
+				served += cw.n
+				mu.Unlock()
+			}))
+			defer srv.Close()
+
+			c := NewClient(WithHTTPClient(srv.Client()), WithTempDir(t.TempDir()))
+			dest := filepath.Join(t.TempDir(), "BuildManifest.plist")
+			i := IPSW{URL: srv.URL + "/test.ipsw", FileSize: int64(len(ipsw))}
+			if err := c.DownloadBuildManifest(t.Context(), i, dest); err != nil {
+				t.Fatalf("DownloadBuildManifest() error = %v", err)
+			}
+			if data, _ := os.ReadFile(dest); !bytes.Equal(data, manifest) {
+				t.Errorf("DownloadBuildManifest() wrote %q, want %q", data, manifest)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if tt.ranges && served >= len(ipsw) {
+				t.Errorf("server sent %d bytes, want less than the %d byte IPSW", served, len(ipsw))
+			}
+		})
+	}
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+	c := NewClient(WithHTTPClient(srv.Client()))
+	i := IPSW{URL: srv.URL + "/test.ipsw", FileSize: int64(len(ipsw))}
+	var se *StatusError
+	if err := c.DownloadBuildManifest(t.Context(), i, filepath.Join(t.TempDir(), "BuildManifest.plist")); !errors.As(err, &se) || se.StatusCode != http.StatusNotFound {
+		t.Errorf("DownloadBuildManifest() error = %v, want a 404 StatusError", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("server got %d requests, want 1 without falling back to a full download", n)
+	}
+}
+
+// countingWriter counts the body bytes written to a ResponseWriter
+type countingWriter struct {
+	http.ResponseWriter
+	n int
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.n += n
+	return n, err
+}
+
+func TestDeviceFamily(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"iPhone16,1", "iPhone"},
+		{"iphone 15,2", "iPhone"},
+		{"iPad13,18", "iPad"},
+		{"iPod9,1", "iPod"},
+		{"Watch7,1", "Watch"},
+		{"AppleTV14,1", "AppleTV"},
+		{"AudioAccessory6,1", "HomePod"},
+		{"Mac14,2", "Mac"},
+		{"MacBookPro18,1", "Mac"},
+		{"iMac21,1", "Mac"},
+		{"VirtualMac2,1", "Mac"},
+		{"iBridge2,1", "unknown"},
+		{"Pixel8", "unknown"},
+		{"", "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := DeviceFamily(tt.in); got != tt.want {
+				t.Errorf("DeviceFamily(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReleaseFeed(t *testing.T) {
+	var mu sync.Mutex
+	releases := []Release{{Version: "17.2", BuildID: "21C62"}}
+	var notModified int
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		etag := fmt.Sprintf(`"%d"`, len(releases))
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(releases)
+	})
+
+	feed := NewReleaseFeed(c, 5*time.Millisecond)
+	defer feed.Close()
+	notified := make(chan []Release, 10)
+	feed.Subscribe(func(releases []Release) { notified <- releases })
+
+	waitFor := func(cond func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out")
+			}
+		}
+	}
+	waitFor(func() bool { mu.Lock(); defer mu.Unlock(); return notModified > 0 })
+
+	mu.Lock()
+	// the duplicate build ID must only be notified once
+	releases = append(releases, Release{Version: "17.3", BuildID: "21D50"}, Release{Version: "17.3", BuildID: "21D50"})
+	mu.Unlock()
+
+	select {
+	case got := <-notified:
+		if len(got) != 1 || got[0].BuildID != "21D50" {
+			t.Errorf("notified of %v, want only 21D50", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the new release")
+	}
+
+	mu.Lock()
+	polled := notModified
+	mu.Unlock()
+	waitFor(func() bool { mu.Lock(); defer mu.Unlock(); return notModified > polled })
+
+	feed.Close()
+	mu.Lock()
+	polled = notModified
+	mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	if notModified != polled {
+		t.Errorf("feed polled %d times after Close", notModified-polled)
+	}
+	mu.Unlock()
+	select {
+	case got := <-notified:
+		t.Errorf("notified again of %v", got)
+	default:
+	}
+}
+
+func TestNotFoundErrors(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	if _, err := c.GetDevice("iPhone99,1"); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("GetDevice() error = %v, want %v", err, ErrDeviceNotFound)
+	}
+	if _, err := c.GetIPSW("iPhone99,1", "99A1"); !errors.Is(err, ErrBuildNotFound) {
+		t.Errorf("GetIPSW() error = %v, want %v", err, ErrBuildNotFound)
+	}
+	var se *StatusError
+	if _, err := c.GetDevice("iPhone99,1"); !errors.As(err, &se) || se.StatusCode != http.StatusNotFound {
+		t.Errorf("GetDevice() error = %v, want a 404 StatusError", err)
+	}
+}
+
+func TestSortIPSWsByVersion(t *testing.T) {
+	ipsws := func(versions ...string) []IPSW {
+		var is []IPSW
+		for idx, v := range versions {
+			is = append(is, IPSW{Version: v, BuildID: fmt.Sprint(idx)})
+		}
+		return is
+	}
+	tests := []struct {
+		name       string
+		ipsws      []IPSW
+		descending bool
+		want       []string
+	}{
+		{"numeric", ipsws("10.0", "9.0", "16.3.1", "16.3", "17.0"), false, []string{"9.0", "10.0", "16.3", "16.3.1", "17.0"}},
+		{"descending", ipsws("9.0", "17.0", "16.3.1"), true, []string{"17.0", "16.3.1", "9.0"}},
+		{"stable", ipsws("17.0", "9.0", "17.0"), false, []string{"9.0", "17.0", "17.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SortIPSWsByVersion(tt.ipsws, tt.descending)
+			var got []string
+			for _, i := range tt.ipsws {
+				got = append(got, i.Version)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("SortIPSWsByVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	stable := ipsws("17.0", "9.0", "17.0")
+	SortIPSWsByVersion(stable, false)
+	if stable[1].BuildID != "0" || stable[2].BuildID != "2" {
+		t.Errorf("SortIPSWsByVersion() reordered equal versions: %v", stable)
+	}
+}
+
+func TestDownloadTo(t *testing.T) {
+	payload := []byte(strings.Repeat("ipsw", 64*1024))
+	sha1sum := fmt.Sprintf("%x", sha1.Sum(payload))
+
+	tests := []struct {
+		name    string
+		sha1    string
+		opts    []ClientOption
+		wantErr error
+	}{
+		{"match", sha1sum, nil, nil},
+		{"mismatch", strings.Repeat("0", 40), nil, ErrChecksumMismatch},
+		{"skip checksum", strings.Repeat("0", 40), []ClientOption{WithSkipChecksum()}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.ServeContent(w, r, "test.ipsw", time.Time{}, bytes.NewReader(payload))
+			}))
+			defer srv.Close()
+
+			var buf bytes.Buffer
+			var downloaded, total int64
+			c := NewClient(append([]ClientOption{WithHTTPClient(srv.Client())}, tt.opts...)...)
+			i := IPSW{URL: srv.URL, FileSize: int64(len(payload)), SHA1: tt.sha1}
+			n, err := c.DownloadTo(t.Context(), i, &buf, func(d, t int64) { downloaded, total = d, t })
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DownloadTo() error = %v, want %v", err, tt.wantErr)
+			}
+			if n != int64(len(payload)) || !bytes.Equal(buf.Bytes(), payload) {
+				t.Errorf("DownloadTo() wrote %d bytes, want %d", n, len(payload))
+			}
+			if downloaded != n || total != i.FileSize {
+				t.Errorf("last progress = %d/%d, want %d/%d", downloaded, total, n, i.FileSize)
+			}
+		})
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	}))
+	defer srv.Close()
+	var buf bytes.Buffer
+	var se *StatusError
+	i := IPSW{URL: srv.URL, FileSize: int64(len(payload))}
+	if n, err := NewClient(WithHTTPClient(srv.Client())).DownloadTo(t.Context(), i, &buf, nil); !errors.As(err, &se) || se.StatusCode != http.StatusGone || n != 0 || buf.Len() != 0 {
+		t.Errorf("DownloadTo() = %d, %v, want nothing written and a 410 StatusError", n, err)
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	payload := []byte(strings.Repeat("ipsw", 1024))
+	sha1sum := fmt.Sprintf("%x", sha1.Sum(payload))
+
+	tests := []struct {
+		name        string
+		honorRanges bool
+	}{
+		{"206", true},
+		{"200 fallback", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotRange string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotRange = r.Header.Get("Range")
+				if !tt.honorRanges {
+					r.Header.Del("Range")
+				}
+				http.ServeContent(w, r, "test.ipsw", time.Time{}, bytes.NewReader(payload))
+			}))
+			defer srv.Close()
+
+			path := filepath.Join(t.TempDir(), "test.ipsw")
+			if err := os.WriteFile(path, payload[:1000], 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			c := NewClient(WithHTTPClient(srv.Client()))
+			i := IPSW{URL: srv.URL, FileSize: int64(len(payload)), SHA1: sha1sum}
+			if err := c.DownloadResume(t.Context(), i, path); err != nil {
+				t.Fatalf("DownloadResume() error = %v", err)
+			}
+			if gotRange != "bytes=1000-" {
+				t.Errorf("server got Range %q, want %q", gotRange, "bytes=1000-")
+			}
+			if got, _ := os.ReadFile(path); !bytes.Equal(got, payload) {
+				t.Errorf("DownloadResume() wrote %d bytes, want the %d payload bytes", len(got), len(payload))
+			}
+		})
+	}
+}
+
+func TestWithUserAgent(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ClientOption
+		want string
+	}{
+		{"default", nil, defaultUserAgent},
+		{"custom", []ClientOption{WithUserAgent("archiver/2.0")}, "archiver/2.0"},
+		{"suffix", []ClientOption{WithUserAgentSuffix("(ci)")}, defaultUserAgent + " (ci)"},
+		{"CRLF rejected", []ClientOption{WithUserAgent("archiver/2.0"), WithUserAgent("archiver/3.0\r\nX-Injected: 1")}, "archiver/2.0"},
+		{"CRLF suffix rejected", []ClientOption{WithUserAgentSuffix("(ci)"), WithUserAgentSuffix("(ci)\r\nX-Injected: 1")}, defaultUserAgent + " (ci)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got, injected string
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				got, injected = r.Header.Get("User-Agent"), r.Header.Get("X-Injected")
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`[]`))
+			}, tt.opts...)
+			if _, err := c.GetReleases(); err != nil {
+				t.Fatalf("GetReleases() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("User-Agent = %q, want %q", got, tt.want)
+			}
+			if injected != "" {
+				t.Errorf("X-Injected = %q, want no injected header", injected)
+			}
+		})
+	}
+}
+
+func TestWithRateLimit(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	}, WithRateLimit(20))
+
+	start := time.Now()
+	for range 3 {
+		if _, err := c.GetReleases(); err != nil {
+			t.Fatalf("GetReleases() error = %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("3 requests at 20/s took %s, want at least 100ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if err := c.getJSON(ctx, "releases", &[]Release{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("getJSON() with a cancelled context error = %v, want %v", err, context.Canceled)
+	}
+
+	// the limiter follows the client's clock: advancing it by a slot per request never waits
+	var offset atomic.Int64
+	epoch := time.Now()
+	c = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	}, WithRateLimit(1), WithClock(func() time.Time { return epoch.Add(time.Duration(offset.Load())) }))
+	start = time.Now()
+	for range 3 {
+		if _, err := c.GetReleases(); err != nil {
+			t.Fatalf("GetReleases() error = %v", err)
+		}
+		offset.Add(int64(time.Second))
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("3 requests at 1/s with the clock advanced 1s each took %s, want no waiting", elapsed)
+	}
+
+	// with the clock frozen the next slot is a second away whatever the wall time
+	ctx, cancel = context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+	if err := c.getJSON(ctx, "releases", &[]Release{}); err != nil {
+		t.Fatalf("getJSON() error = %v", err)
+	}
+	if err := c.getJSON(ctx, "releases", &[]Release{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("getJSON() on a frozen clock error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestFilterIPSWsBySize(t *testing.T) {
+	ipsws := []IPSW{
+		{BuildID: "small", FileSize: 100},
+		{BuildID: "medium", FileSize: 500},
+		{BuildID: "large", FileSize: 6 << 30},
+	}
+	tests := []struct {
+		name     string
+		ipsws    []IPSW
+		min, max int64
+		want     []string
+	}{
+		{"inclusive range", ipsws, 100, 500, []string{"small", "medium"}},
+		{"unbounded max", ipsws, 500, 0, []string{"medium", "large"}},
+		{"everything", ipsws, 0, 0, []string{"small", "medium", "large"}},
+		{"under 6 GiB", ipsws, 0, 6<<30 - 1, []string{"small", "medium"}},
+		{"no match", ipsws, 101, 499, nil},
+		{"empty input", nil, 0, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FilterIPSWsBySize(tt.ipsws, tt.min, tt.max)
+			if got == nil {
+				t.Fatal("FilterIPSWsBySize() = nil, want an empty slice")
+			}
+			var builds []string
+			for _, i := range got {
+				builds = append(builds, i.BuildID)
+			}
+			if !slices.Equal(builds, tt.want) {
+				t.Errorf("FilterIPSWsBySize() = %v, want %v", builds, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetNewestBuildForVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr error
+	}{
+		{"most devices", `[{"identifier":"iPhone15,2","buildid":"20D47"},{"identifier":"iPhone14,6","buildid":"20D47"},{"identifier":"iPhone12,8","buildid":"20D50"}]`, "20D47", nil},
+		{"newest upload breaks ties", `[{"identifier":"iPhone15,2","buildid":"20D47","uploaddate":"2023-01-23T00:00:00Z"},{"identifier":"iPhone12,8","buildid":"20D50","uploaddate":"2023-01-24T00:00:00Z"}]`, "20D50", nil},
+		{"highest build breaks ties", `[{"identifier":"iPhone15,2","buildid":"20D50"},{"identifier":"iPhone12,8","buildid":"20D47"}]`, "20D50", nil},
+		{"no ipsws", `[]`, "", ErrVersionNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.body))
+			})
+			got, err := c.GetNewestBuildForVersion("16.3")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetNewestBuildForVersion() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetNewestBuildForVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetOTA(t *testing.T) {
+	var gotPath string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"identifier":"iPhone15,2","buildid":"20D47","filesize":1024}`))
+	})
+	o, err := c.GetOTA("iphone15,2", "20D47")
+	if err != nil {
+		t.Fatalf("GetOTA() error = %v", err)
+	}
+	if want := "/ota/download/iPhone15,2/20D47"; gotPath != want {
+		t.Errorf("GetOTA() requested %q, want %q", gotPath, want)
+	}
+	if o.BuildID != "20D47" || o.FileSize != 1024 {
+		t.Errorf("GetOTA() = %+v, want build 20D47 of 1024 bytes", o)
+	}
+}
+
+func TestGetVersion(t *testing.T) {
+	firmwares := map[string]string{
+		"iPhone9,1":  `[{"identifier":"iPhone9,1","version":"16.3.0","buildid":"20D47"}]`,
+		"iPhone15,2": `[{"identifier":"iPhone15,2","version":"16.3","buildid":"20D47"}]`,
+		"iPhone14,6": `[{"identifier":"iPhone14,6","version":"16.2","buildid":"20C65"}]`,
+	}
+	tests := []struct {
+		name    string
+		buildID string
+		failing string
+		want    string
+		wantErr error
+	}{
+		{"newest generation wins", "20D47", "", "16.3", nil},
+		{"older devices still searched", "20C65", "", "16.2", nil},
+		{"not found", "99A1", "", "", ErrVersionNotFound},
+		{"not found reports failures", "99A1", "iPhone14,6", "", ErrVersionNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if r.URL.Path == "/devices" {
+					// catalog order puts the oldest device first when sorted as strings
+					w.Write([]byte(`[{"identifier":"iPhone14,6"},{"identifier":"iPhone15,2"},{"identifier":"iPhone9,1"}]`))
+					return
+				}
+				id := strings.TrimPrefix(r.URL.Path, "/device/")
+				if id == tt.failing {
+					http.Error(w, "unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				fmt.Fprintf(w, `{"identifier":%q,"firmwares":%s}`, id, firmwares[id])
+			})
+			got, err := c.GetVersion(tt.buildID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetVersion() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetVersion() = %q, want %q", got, tt.want)
+			}
+			var se *StatusError
+			if failed := errors.As(err, &se); failed != (tt.failing != "") {
+				t.Errorf("GetVersion() error = %v, want the device failure reported: %v", err, tt.failing != "")
+			}
+		})
+	}
+
+	var inFlight, peak, requests atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/devices" {
+			w.Write([]byte(`[{"identifier":"iPhone10,1"},{"identifier":"iPhone11,2"},{"identifier":"iPhone12,1"},{"identifier":"iPhone13,2"},{"identifier":"iPhone14,5"},{"identifier":"iPhone15,4"}]`))
+			return
+		}
+		requests.Add(1)
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(10 * time.Millisecond)
+		id := strings.TrimPrefix(r.URL.Path, "/device/")
+		fmt.Fprintf(w, `{"identifier":%q,"firmwares":[]}`, id)
+	}, WithMaxConcurrency(2))
+	if _, err := c.GetVersion("99A1"); !errors.Is(err, ErrVersionNotFound) {
+		t.Fatalf("GetVersion() error = %v, want %v", err, ErrVersionNotFound)
+	}
+	if n := requests.Load(); n != 6 {
+		t.Errorf("GetVersion() fetched %d devices, want all 6", n)
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("GetVersion() made %d concurrent requests, want at most 2", p)
+	}
+}
+
+func TestCompareIdentifiers(t *testing.T) {
+	ids := []string{"iPhone15,2", "iPhone9,1", "iPhone14,6", "iPhone15,10", "VMA2MacOSAP", "iPhone10,3"}
+	slices.SortFunc(ids, compareIdentifiers)
+	want := []string{"VMA2MacOSAP", "iPhone9,1", "iPhone10,3", "iPhone14,6", "iPhone15,2", "iPhone15,10"}
+	if !slices.Equal(ids, want) {
+		t.Errorf("sorted identifiers = %v, want %v", ids, want)
+	}
+}
+
+func TestClientSELookups(t *testing.T) {
+	firmwares := map[string]string{
+		"iPhone12,8": `[{"identifier":"iPhone12,8","version":"16.3","buildid":"20D47"},{"identifier":"iPhone12,8","version":"15.0","buildid":"19A346"}]`,
+		"iPhone14,6": `[{"identifier":"iPhone14,6","version":"16.3","buildid":"20D47"},{"identifier":"iPhone14,6","version":"16.4","buildid":"20E247"}]`,
+	}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/device/")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"identifier":%q,"firmwares":%s}`, id, firmwares[id])
+	})
+
+	pairs, err := c.GetCompatiblePairs()
+	if err != nil || len(pairs) != 1 || pairs[0].SE2.BuildID != "20D47" || pairs[0].SE3.BuildID != "20D47" {
+		t.Errorf("GetCompatiblePairs() = %+v, %v, want the 16.3 pair", pairs, err)
+	}
+	ipsws, err := c.GetCompatibleIPSWs("16.3")
+	if err != nil || len(ipsws) != 1 || ipsws[0].Identifier != "iPhone14,6" {
+		t.Errorf("GetCompatibleIPSWs() = %v, %v, want the SE3 16.3 IPSW", ipsws, err)
+	}
+	if i, err := c.GetSE3IPSWForSE2Version("16.3.0"); err != nil || i.BuildID != "20D47" {
+		t.Errorf("GetSE3IPSWForSE2Version() = %v, %v, want 20D47", i, err)
+	}
+	if _, err := c.GetSE3IPSWForSE2Version("15.0"); !errors.Is(err, ErrBuildNotFound) {
+		t.Errorf("GetSE3IPSWForSE2Version() error = %v, want %v", err, ErrBuildNotFound)
+	}
+}
+
+func TestGetDeviceFirmwareKeys(t *testing.T) {
+	var paths []string
+	var mu sync.Mutex
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/keys/device/iPhone15,2":
+			w.Write([]byte(`[{"buildid":"20D47","keys":[{"image":"iBoot","key":"aa"}]},{"buildid":"20C65"},{"buildid":"20B82"}]`))
+		case "/keys/ipsw/iPhone15,2/20C65":
+			w.Write([]byte(`{"buildid":"20C65","keys":[{"image":"iBEC","key":"bb"}]}`))
+		default:
+			w.Write([]byte(`{"buildid":"20B82"}`))
+		}
+	})
+
+	keys, err := c.GetDeviceFirmwareKeys(t.Context(), "iphone15,2")
+	if err != nil {
+		t.Fatalf("GetDeviceFirmwareKeys() error = %v", err)
+	}
+	if len(keys) != 2 || keys["20D47"][0].Key != "aa" || keys["20C65"][0].Key != "bb" {
+		t.Errorf("GetDeviceFirmwareKeys() = %v, want the keys of 20D47 and 20C65", keys)
+	}
+	if slices.Contains(paths, "/keys/ipsw/iPhone15,2/20D47") || len(paths) != 3 {
+		t.Errorf("requested %v, want only the builds listed without keys fetched", paths)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := c.GetDeviceFirmwareKeys(ctx, "iPhone15,2"); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetDeviceFirmwareKeys() with a cancelled context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestDownloadDeadline(t *testing.T) {
+	prev := minDownloadAttempt
+	minDownloadAttempt = 100 * time.Millisecond
+	t.Cleanup(func() { minDownloadAttempt = prev })
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		// send a little and then stall until the attempt gives up
+		w.Write([]byte("ipsw"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithHTTPClient(srv.Client()), WithDownloadRetry(3, 10*time.Millisecond), WithDownloadAttemptTimeout(150*time.Millisecond))
+	i := IPSW{URL: srv.URL, FileSize: 1024}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.DownloadIPSW(ctx, i, filepath.Join(t.TempDir(), "test.ipsw")); !errors.Is(err, ErrDeadlineTooShort) {
+		t.Errorf("DownloadIPSW() error = %v, want %v", err, ErrDeadlineTooShort)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("server got %d requests, want none with too little time left", n)
+	}
+
+	ctx, cancel = context.WithTimeout(t.Context(), 400*time.Millisecond)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	err := c.DownloadIPSW(ctx, i, filepath.Join(t.TempDir(), "test.ipsw"))
+	if !errors.Is(err, ErrDeadlineTooShort) {
+		t.Errorf("DownloadIPSW() error = %v, want %v", err, ErrDeadlineTooShort)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("server got %d requests, want 2 attempts capped at 150ms each", n)
+	}
+	if time.Now().After(deadline) {
+		t.Error("DownloadIPSW() returned after the context deadline")
+	}
+
+	// the last attempt's error is still reachable through ErrDeadlineTooShort
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	c = NewClient(WithHTTPClient(unavailable.Client()), WithDownloadRetry(3, 100*time.Millisecond))
+	ctx, cancel = context.WithTimeout(t.Context(), 150*time.Millisecond)
+	defer cancel()
+	err = c.DownloadIPSW(ctx, IPSW{URL: unavailable.URL, FileSize: 1024}, filepath.Join(t.TempDir(), "test.ipsw"))
+	var se *StatusError
+	if !errors.Is(err, ErrDeadlineTooShort) || !errors.As(err, &se) || se.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("DownloadIPSW() error = %v, want %v wrapping a 503 StatusError", err, ErrDeadlineTooShort)
+	}
+}
+
+func TestUnexpectedContent(t *testing.T) {
+	const page = `<!DOCTYPE html><html><body>Service temporarily unavailable</body></html>`
+	tests := []struct {
+		name        string
+		contentType string
+		opts        []ClientOption
+	}{
+		{"html", "text/html; charset=utf-8", nil},
+		{"html cached", "text/html; charset=utf-8", []ClientOption{WithCache(time.Minute)}},
+		{"html labeled json", "application/json", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(page))
+			}, tt.opts...)
+			if _, err := c.GetAllDevices(); !errors.Is(err, ErrUnexpectedContent) {
+				t.Errorf("GetAllDevices() error = %v, want %v", err, ErrUnexpectedContent)
+			}
+		})
+	}
+}
+
+func TestGetLatestIPSWPerCallOptions(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"identifier":"iPhone15,2","firmwares":[` +
+			`{"identifier":"iPhone15,2","buildid":"20E5212f","releasedate":"2023-02-15T00:00:00Z"},` +
+			`{"identifier":"iPhone15,2","buildid":"20D47","releasedate":"2023-01-23T00:00:00Z","signed":true}]}`))
+	})
+
+	if i, err := c.GetLatestIPSW("iPhone15,2", WithPreferSigned()); err != nil || i.BuildID != "20D47" {
+		t.Errorf("GetLatestIPSW(WithPreferSigned()) = %v, %v, want 20D47", i, err)
+	}
+	if c.preferSigned {
+		t.Error("GetLatestIPSW(WithPreferSigned()) modified the client")
+	}
+	if i, err := c.GetLatestIPSW("iPhone15,2"); err != nil || i.BuildID != "20E5212f" {
+		t.Errorf("GetLatestIPSW() after a per-call option = %v, %v, want 20E5212f", i, err)
+	}
+}
+
+func TestMoveFileAcrossFilesystems(t *testing.T) {
+	t.Cleanup(func() { renameFile = os.Rename })
+	renameFile = func(src, dst string) error {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: syscall.EXDEV}
+	}
+
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "test.ipsw.part"), filepath.Join(dir, "test.ipsw")
+	payload := []byte(strings.Repeat("ipsw", 1024))
+	if err := os.WriteFile(src, payload, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := moveFile(src, dst); err != nil {
+		t.Fatalf("moveFile() error = %v", err)
+	}
+	if data, _ := os.ReadFile(dst); !bytes.Equal(data, payload) {
+		t.Errorf("moveFile() copied %d bytes, want %d", len(data), len(payload))
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("moveFile() left %d files behind, want only %s", len(entries)-1, dst)
+	}
+	if fi, err := os.Stat(dst); err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != 0644 {
+		t.Errorf("moveFile() copy has mode %v, want the source's 0644", fi.Mode().Perm())
+	}
+
+	renameFile = func(src, dst string) error {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: syscall.EACCES}
+	}
+	if err := os.WriteFile(src, payload, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := moveFile(src, dst); !errors.Is(err, syscall.EACCES) {
+		t.Errorf("moveFile() error = %v, want %v without copying", err, syscall.EACCES)
+	}
+}
+
+func TestGetIPSWFirmwareListFallback(t *testing.T) {
+	var paths []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if strings.HasPrefix(r.URL.Path, "/ipsw/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"identifier":"iPhone15,2","firmwares":[{"identifier":"iPhone15,2","version":"16.3","buildid":"20D47"}]}`))
+	})
+
+	i, err := c.GetIPSW("iPhone15,2", "20D47")
+	if err != nil || i.Version != "16.3" {
+		t.Errorf("GetIPSW() = %v, %v, want 16.3 from the firmware list", i, err)
+	}
+	if want := []string{"/ipsw/iPhone15,2/20D47", "/device/iPhone15,2"}; !slices.Equal(paths, want) {
+		t.Errorf("requested %v, want %v", paths, want)
+	}
+
+	if _, err := c.GetIPSW("iPhone15,2", "99A1"); !errors.Is(err, ErrBuildNotFound) || !isNotFound(err) {
+		t.Errorf("GetIPSW() error = %v, want %v wrapping the 404", err, ErrBuildNotFound)
+	}
+}
+
+func TestDownloadIfMissing(t *testing.T) {
+	payload := []byte(strings.Repeat("ipsw", 1024))
+	sha1sum := fmt.Sprintf("%x", sha1.Sum(payload))
+
+	tests := []struct {
+		name           string
+		existing       []byte
+		wantDownloaded bool
+	}{
+		{"present and matching", payload, false},
+		{"corrupt", bytes.Repeat([]byte("x"), len(payload)), true},
+		{"truncated", payload[:1000], true},
+		{"missing", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				http.ServeContent(w, r, "test.ipsw", time.Time{}, bytes.NewReader(payload))
+			}))
+			defer srv.Close()
+
+			dest := filepath.Join(t.TempDir(), "test.ipsw")
+			if tt.existing != nil {
+				if err := os.WriteFile(dest, tt.existing, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			c := NewClient(WithHTTPClient(srv.Client()))
+			i := IPSW{URL: srv.URL, FileSize: int64(len(payload)), SHA1: sha1sum}
+			downloaded, err := c.DownloadIfMissing(t.Context(), i, dest)
+			if err != nil {
+				t.Fatalf("DownloadIfMissing() error = %v", err)
+			}
+			if downloaded != tt.wantDownloaded {
+				t.Errorf("DownloadIfMissing() = %v, want %v", downloaded, tt.wantDownloaded)
+			}
+			if got := requests.Load() > 0; got != tt.wantDownloaded {
+				t.Errorf("server got %d requests, want requests %v", requests.Load(), tt.wantDownloaded)
+			}
+			if data, _ := os.ReadFile(dest); !bytes.Equal(data, payload) {
+				t.Errorf("dest has %d bytes, want the %d byte payload", len(data), len(payload))
+			}
+		})
+	}
+}
+
+func TestVerifyAndRepair(t *testing.T) {
+	payload := []byte(strings.Repeat("ipsw", 1024))
+	sha1sum := fmt.Sprintf("%x", sha1.Sum(payload))
+	corruptPrefix := bytes.Repeat([]byte("x"), 1000)
+
+	tests := []struct {
+		name       string
+		existing   []byte
+		want       RepairResult
+		wantRanges []string
+	}{
+		{"intact", payload, RepairNone, nil},
+		{"missing", nil, RepairMissing, []string{""}},
+		{"corrupt", bytes.Repeat([]byte("x"), len(payload)), RepairCorrupt, []string{""}},
+		{"truncated", payload[:1000], RepairCorrupt, []string{"bytes=1000-"}},
+		{"truncated and corrupt", corruptPrefix, RepairCorrupt, []string{"bytes=1000-", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var ranges []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				ranges = append(ranges, r.Header.Get("Range"))
+				mu.Unlock()
+				http.ServeContent(w, r, "test.ipsw", time.Time{}, bytes.NewReader(payload))
+			}))
+			defer srv.Close()
+
+			dest := filepath.Join(t.TempDir(), "test.ipsw")
+			if tt.existing != nil {
+				if err := os.WriteFile(dest, tt.existing, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			c := NewClient(WithHTTPClient(srv.Client()))
+			i := IPSW{URL: srv.URL, FileSize: int64(len(payload)), SHA1: sha1sum}
+			got, err := c.VerifyAndRepair(t.Context(), i, dest)
+			if err != nil {
+				t.Fatalf("VerifyAndRepair() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("VerifyAndRepair() = %v, want %v", got, tt.want)
+			}
+			if !slices.Equal(ranges, tt.wantRanges) {
+				t.Errorf("server got Range headers %q, want %q", ranges, tt.wantRanges)
+			}
+			if data, _ := os.ReadFile(dest); !bytes.Equal(data, payload) {
+				t.Errorf("dest has %d bytes, want the %d byte payload", len(data), len(payload))
+			}
+		})
+	}
+}
+
+func TestIPSWVerifyFile(t *testing.T) {
+	payload := []byte(strings.Repeat("ipsw", 1024))
+	sha1sum := fmt.Sprintf("%x", sha1.Sum(payload))
+	md5sum := fmt.Sprintf("%x", md5.Sum(payload))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		ipsw    IPSW
+		wantErr error
+	}{
+		{"match", payload, IPSW{FileSize: int64(len(payload)), SHA1: sha1sum, MD5: md5sum}, nil},
+		{"match uppercase", payload, IPSW{SHA1: strings.ToUpper(sha1sum)}, nil},
+		{"no checksums", payload, IPSW{}, nil},
+		{"sha1 mismatch", payload, IPSW{SHA1: strings.Repeat("0", 40), MD5: md5sum}, ErrChecksumMismatch},
+		{"md5 mismatch", payload, IPSW{SHA1: sha1sum, MD5: strings.Repeat("0", 32)}, ErrChecksumMismatch},
+		{"wrong size", payload[:1000], IPSW{FileSize: int64(len(payload)), SHA1: sha1sum}, ErrChecksumMismatch},
+		{"wrong size without size", payload[:1000], IPSW{SHA1: sha1sum}, ErrChecksumMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.ipsw")
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.ipsw.VerifyFile(path); !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyFile() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := (IPSW{}).VerifyFile(filepath.Join(t.TempDir(), "missing.ipsw")); err == nil || errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("VerifyFile() of a missing file error = %v, want an open error", err)
+	}
+}
+
+func TestDiffDevices(t *testing.T) {
+	ids := func(devices []Device) []string {
+		var s []string
+		for _, d := range devices {
+			s = append(s, d.Identifier+"="+d.Name)
+		}
+		return s
+	}
+	tests := []struct {
+		name                    string
+		old, new                []Device
+		added, removed, renamed []string
+	}{
+		{
+			"added removed and renamed",
+			[]Device{{Identifier: "iPhone15,2", Name: "iPhone 14 Pro"}, {Identifier: "iPhone14,6", Name: "iPhone SE (3rd generation)"}, {Identifier: "iPhone12,8", Name: "iPhone SE 2"}},
+			[]Device{{Identifier: "iPhone16,2", Name: "iPhone 15 Pro Max"}, {Identifier: "iPhone12,8", Name: "iPhone SE (2nd generation)"}, {Identifier: "iPhone16,1", Name: "iPhone 15 Pro"}, {Identifier: "iPhone15,2", Name: "iPhone 14 Pro"}},
+			[]string{"iPhone16,1=iPhone 15 Pro", "iPhone16,2=iPhone 15 Pro Max"},
+			[]string{"iPhone14,6=iPhone SE (3rd generation)"},
+			[]string{"iPhone12,8=iPhone SE (2nd generation)"},
+		},
+		{"unchanged", []Device{{Identifier: "iPhone15,2", Name: "iPhone 14 Pro"}}, []Device{{Identifier: "iPhone15,2", Name: "iPhone 14 Pro"}}, nil, nil, nil},
+		{"first snapshot", nil, []Device{{Identifier: "iPhone15,2"}}, []string{"iPhone15,2="}, nil, nil},
+		{"name cleared", []Device{{Identifier: "iPhone15,2", Name: "iPhone 14 Pro"}}, []Device{{Identifier: "iPhone15,2"}}, nil, nil, []string{"iPhone15,2="}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed, renamed := DiffDevices(tt.old, tt.new)
+			if got := ids(added); !slices.Equal(got, tt.added) {
+				t.Errorf("added = %v, want %v", got, tt.added)
+			}
+			if got := ids(removed); !slices.Equal(got, tt.removed) {
+				t.Errorf("removed = %v, want %v", got, tt.removed)
+			}
+			if got := ids(renamed); !slices.Equal(got, tt.renamed) {
+				t.Errorf("renamed = %v, want %v", got, tt.renamed)
+			}
+		})
+	}
+}
+
+func TestSigningHistory(t *testing.T) {
+	snapshot := func(signed ...bool) []IPSW {
+		builds := []string{"20D47", "20C65"}
+		var s []IPSW
+		for idx, sig := range signed {
+			s = append(s, IPSW{Identifier: "iPhone15,2", BuildID: builds[idx], Signed: sig})
+		}
+		return s
+	}
+	tests := []struct {
+		name      string
+		snapshots [][]IPSW
+		want      []SigningEvent
+	}{
+		{"no snapshots", nil, []SigningEvent{}},
+		{"unchanged", [][]IPSW{snapshot(true, true), snapshot(true, true)}, []SigningEvent{}},
+		{
+			"signing closes then reopens",
+			[][]IPSW{snapshot(true, true), snapshot(true, false), snapshot(true, false), snapshot(true, true)},
+			[]SigningEvent{
+				{BuildID: "20C65", Identifier: "iPhone15,2", Signed: false, At: 1},
+				{BuildID: "20C65", Identifier: "iPhone15,2", Signed: true, At: 3},
+			},
+		},
+		{
+			"missing build keeps its status",
+			[][]IPSW{snapshot(true, true), snapshot(true), snapshot(true, false)},
+			[]SigningEvent{{BuildID: "20C65", Identifier: "iPhone15,2", Signed: false, At: 2}},
+		},
+		{
+			"first appearance is not an event",
+			[][]IPSW{snapshot(true), snapshot(false, true)},
+			[]SigningEvent{{BuildID: "20D47", Identifier: "iPhone15,2", Signed: false, At: 1}},
+		},
+		{
+			"same snapshot ordered by identifier",
+			[][]IPSW{
+				{{Identifier: "iPhone15,2", BuildID: "20D47", Signed: true}, {Identifier: "iPhone14,6", BuildID: "20D47", Signed: true}},
+				{{Identifier: "iPhone15,2", BuildID: "20D47"}, {Identifier: "iPhone14,6", BuildID: "20D47"}},
+			},
+			[]SigningEvent{
+				{BuildID: "20D47", Identifier: "iPhone14,6", Signed: false, At: 1},
+				{BuildID: "20D47", Identifier: "iPhone15,2", Signed: false, At: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SigningHistory(tt.snapshots); !slices.Equal(got, tt.want) {
+				t.Errorf("SigningHistory() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDeviceIPSWsOpts(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"identifier":"iPhone15,2","firmwares":[` +
+			`{"buildid":"20E247","version":"16.4","url":"https://updates.cdn-apple.com/a.ipsw","signed":true},` +
+			`{"buildid":"20E5212f","version":"16.4","signed":true},` +
+			`{"buildid":"20D47","version":"16.3","url":"https://updates.cdn-apple.com/b.ipsw"},` +
+			`{"buildid":"19A346","version":"15.0","url":"https://updates.cdn-apple.com/c.ipsw"},` +
+			`{"buildid":"19A5261w","version":"15.0"}]}`))
+	})
+	versions := func(lo, hi string) *VersionRange {
+		r := &VersionRange{}
+		r.Min, _ = ParseVersion(lo)
+		if hi != "" {
+			r.Max, _ = ParseVersion(hi)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name string
+		opts IPSWListOptions
+		want []string
+	}{
+		{"default", IPSWListOptions{}, []string{"20E247"}},
+		{"unsigned", IPSWListOptions{IncludeUnsigned: true}, []string{"20E247", "20D47", "19A346"}},
+		{"pulled", IPSWListOptions{IncludePulled: true}, []string{"20E247", "20E5212f"}},
+		{"everything", IncludeAllIPSWs, []string{"20E247", "20E5212f", "20D47", "19A346", "19A5261w"}},
+		{"unsigned in range", IPSWListOptions{IncludeUnsigned: true, VersionRange: versions("16.0", "16.3")}, []string{"20D47"}},
+		{"everything from 16.3", IPSWListOptions{IncludeUnsigned: true, IncludePulled: true, VersionRange: versions("16.3", "")}, []string{"20E247", "20E5212f", "20D47"}},
+		{"range excludes unsigned by default", IPSWListOptions{VersionRange: versions("15.0", "16.3")}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipsws, err := c.GetDeviceIPSWsOpts("iPhone15,2", tt.opts)
+			if err != nil {
+				t.Fatalf("GetDeviceIPSWsOpts() error = %v", err)
+			}
+			got := []string{}
+			for _, i := range ipsws {
+				got = append(got, i.BuildID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("GetDeviceIPSWsOpts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadProgressLogging(t *testing.T) {
+	payload := []byte(strings.Repeat("ipsw", 16*1024))
+	tests := []struct {
+		name     string
+		interval time.Duration
+	}{
+		{"final line only", time.Hour},
+		{"periodic lines", time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for chunk := range slices.Chunk(payload, 8*1024) {
+					w.Write(chunk)
+					w.(http.Flusher).Flush()
+					time.Sleep(2 * time.Millisecond)
+				}
+			}))
+			defer srv.Close()
+
+			handler := memory.New()
+			logger := &log.Logger{Handler: handler, Level: log.InfoLevel}
+			c := NewClient(WithHTTPClient(srv.Client()), WithLogger(logger), WithProgressLogging(tt.interval))
+			i := IPSW{URL: srv.URL, FileSize: int64(len(payload))}
+			if err := c.DownloadIPSW(t.Context(), i, filepath.Join(t.TempDir(), "test.ipsw")); err != nil {
+				t.Fatalf("DownloadIPSW() error = %v", err)
+			}
+
+			if len(handler.Entries) == 0 {
+				t.Fatal("no progress line was logged")
+			}
+			last := handler.Entries[len(handler.Entries)-1]
+			if last.Message != "Downloading" || last.Fields.Get("percent") != "100.0%" {
+				t.Errorf("last line = %q %v, want the download at 100.0%%", last.Message, last.Fields)
+			}
+		})
+	}
+}
+
+func TestUpgradeDownloadSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		otas     string
+		from     string
+		want     int64
+		wantPath UpgradePath
+	}{
+		{"direct delta", `[{"buildid":"20C","prerequisitebuildid":"20A","filesize":100}]`, "20A", 100, UpgradePathOTA},
+		{"cheaper multi-hop chain", `[{"buildid":"20C","prerequisitebuildid":"20A","filesize":500},
+			{"buildid":"20B","prerequisitebuildid":"20A","filesize":100},
+			{"buildid":"20C","prerequisitebuildid":"20B","filesize":150}]`, "20A", 250, UpgradePathOTA},
+		{"missing prerequisite", `[{"buildid":"20C","prerequisitebuildid":"20B","filesize":100}]`, "20A", 5000, UpgradePathFullRestore},
+		{"equal builds", `[]`, "20C", 0, UpgradePathOTA},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Path {
+				case "/device/iPhone15,2":
+					fmt.Fprintf(w, `{"identifier":"iPhone15,2","firmwares":%s}`, tt.otas)
+				case "/ipsw/iPhone15,2/20C":
+					w.Write([]byte(`{"identifier":"iPhone15,2","buildid":"20C","filesize":5000}`))
+				default:
+					http.NotFound(w, r)
+				}
+			})
+			got, path, err := c.UpgradeDownloadSize("iPhone15,2", tt.from, "20C")
+			if err != nil {
+				t.Fatalf("UpgradeDownloadSize() error = %v", err)
+			}
+			if got != tt.want || path != tt.wantPath {
+				t.Errorf("UpgradeDownloadSize() = %d, %q, want %d, %q", got, path, tt.want, tt.wantPath)
+			}
+			if tt.from == "20C" && requests.Load() != 0 {
+				t.Errorf("UpgradeDownloadSize() made %d requests for equal builds, want 0", requests.Load())
+			}
+		})
+	}
+}
+
+func TestDownloadUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		otas      string
+		from      string
+		wantPath  UpgradePath
+		wantFiles []string
+	}{
+		{"ota chain in apply order", `[{"buildid":"20C","prerequisitebuildid":"20B","filesize":4,"url":"/files/b-c.zip"},
+			{"buildid":"20B","prerequisitebuildid":"20A","filesize":4,"url":"/files/a-b.zip"}]`, "20A", UpgradePathOTA, []string{"a-b.zip", "b-c.zip"}},
+		{"ipsw fallback", `[{"buildid":"20C","prerequisitebuildid":"20B","filesize":4,"url":"/files/b-c.zip"}]`, "19A", UpgradePathFullRestore, []string{"20C.ipsw"}},
+		{"equal builds", `[]`, "20C", UpgradePathOTA, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				base := "http://" + r.Host
+				switch {
+				case r.URL.Path == "/device/iPhone15,2":
+					w.Header().Set("Content-Type", "application/json")
+					fmt.Fprintf(w, `{"identifier":"iPhone15,2","firmwares":%s}`, strings.ReplaceAll(tt.otas, `"/files/`, `"`+base+`/files/`))
+				case r.URL.Path == "/ipsw/iPhone15,2/20C":
+					w.Header().Set("Content-Type", "application/json")
+					fmt.Fprintf(w, `{"identifier":"iPhone15,2","buildid":"20C","filesize":4,"url":%q}`, base+"/files/20C.ipsw")
+				case strings.HasPrefix(r.URL.Path, "/files/"):
+					w.Write([]byte("data"))
+				default:
+					http.NotFound(w, r)
+				}
+			}, WithSkipChecksum())
+			dir := t.TempDir()
+			dl, err := c.DownloadUpdate(t.Context(), "iPhone15,2", tt.from, "20C", dir)
+			if err != nil {
+				t.Fatalf("DownloadUpdate() error = %v", err)
+			}
+			var want []string
+			for _, f := range tt.wantFiles {
+				want = append(want, filepath.Join(dir, f))
+			}
+			if dl.Path != tt.wantPath || !slices.Equal(dl.Files, want) {
+				t.Errorf("DownloadUpdate() = %q %v, want %q %v", dl.Path, dl.Files, tt.wantPath, want)
+			}
+			for _, f := range dl.Files {
+				if b, err := os.ReadFile(f); err != nil || string(b) != "data" {
+					t.Errorf("%s = %q, %v, want the served file", f, b, err)
+				}
+			}
+		})
+	}
+}
+
+func TestGetCommonSignedVersion(t *testing.T) {
+	tests := []struct {
+		name      string
+		firmwares map[string]string
+		want      string
+		wantErr   bool
+	}{
+		{"newest of the intersection", map[string]string{
+			"iPhone15,2": `[{"version":"17.1","signed":true},{"version":"16.6","signed":true},{"version":"16.7"}]`,
+			"iPhone9,1":  `[{"version":"16.7","signed":true},{"version":"16.6","signed":true},{"version":"15.7","signed":true}]`,
+		}, "16.6", false},
+		{"unparseable versions considered", map[string]string{
+			"iPhone15,2": `[{"version":"16.7 (20H19)","signed":true},{"version":"16.6","signed":true}]`,
+			"iPhone9,1":  `[{"version":"16.7 (20H19)","signed":true},{"version":"16.6","signed":true}]`,
+		}, "16.7 (20H19)", false},
+		{"empty intersection", map[string]string{
+			"iPhone15,2": `[{"version":"17.1","signed":true}]`,
+			"iPhone9,1":  `[{"version":"16.7","signed":true}]`,
+		}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				id := strings.TrimPrefix(r.URL.Path, "/device/")
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"identifier":%q,"firmwares":%s}`, id, tt.firmwares[id])
+			})
+			got, err := c.GetCommonSignedVersion(t.Context(), []string{"iPhone15,2", "iPhone9,1"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetCommonSignedVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetCommonSignedVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildIndex(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/releases":
+			w.Write([]byte(`[{"version":"17.2","buildid":"21C62"},{"version":"","buildid":"21A5248v"}]`))
+		case "/devices":
+			w.Write([]byte(`[{"identifier":"iPhone15,2"},{"identifier":"iPhone9,1"}]`))
+		case "/device/iPhone15,2":
+			w.Write([]byte(`{"identifier":"iPhone15,2","firmwares":[{"version":"17.2.0","buildid":"21C62"},{"version":"16.3","buildid":"20D47"}]}`))
+		default:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}, WithRetry(1, 0))
+
+	index, err := c.BuildIndex(t.Context(), false)
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+	if want := map[string]string{"21C62": "17.2"}; !maps.Equal(index, want) {
+		t.Errorf("BuildIndex() = %v, want %v", index, want)
+	}
+
+	// the releases entry wins and the failed device doesn't drop the scanned ones
+	index, err = c.BuildIndex(t.Context(), true)
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("BuildIndex() error = %v, want the failed device's 503", err)
+	}
+	if want := map[string]string{"21C62": "17.2", "20D47": "16.3"}; !maps.Equal(index, want) {
+		t.Errorf("BuildIndex() = %v, want %v", index, want)
+	}
+}
+
+func TestResolveURLs(t *testing.T) {
+	var filledRequests atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ipsw/iPhone15,2/20D47":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"identifier":"iPhone15,2","buildid":"20D47","url":"https://updates.cdn-apple.com/20D47.ipsw"}`))
+		case "/ipsw/iPhone9,1/19A346":
+			filledRequests.Add(1)
+			http.NotFound(w, r)
+		default:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}, WithRetry(1, 0))
+
+	ipsws := []IPSW{
+		{Identifier: "iPhone15,2", BuildID: "20D47"},
+		{Identifier: "iPhone14,6", BuildID: "20C65"},
+		{Identifier: "iPhone9,1", BuildID: "19A346", URL: "https://example.com/19A346.ipsw"},
+	}
+	input := slices.Clone(ipsws)
+
+	resolved, err := c.ResolveURLs(t.Context(), ipsws, 2)
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("ResolveURLs() error = %v, want the failed entry's 503", err)
+	}
+	want := []string{"https://updates.cdn-apple.com/20D47.ipsw", "", "https://example.com/19A346.ipsw"}
+	for idx, i := range resolved {
+		if i.URL != want[idx] {
+			t.Errorf("ResolveURLs()[%d].URL = %q, want %q", idx, i.URL, want[idx])
+		}
+	}
+	if n := filledRequests.Load(); n != 0 {
+		t.Errorf("server got %d requests for the entry with a URL, want none", n)
+	}
+	if !slices.EqualFunc(ipsws, input, func(a, b IPSW) bool { return a.URL == b.URL }) {
+		t.Errorf("ResolveURLs() modified its input: %v", ipsws)
+	}
+}
+
+func TestSigningWindow(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"identifier":"iPhone15,2","firmwares":[
+			{"buildid":"20A362","releasedate":"2022-09-12T00:00:00Z"},
+			{"buildid":"20C65","releasedate":"2022-12-13T00:00:00Z"},
+			{"buildid":"20B82","releasedate":"2022-10-24T00:00:00Z"},
+			{"buildid":"20D47","uploaddate":"2023-01-23T00:00:00Z","signed":true},
+			{"buildid":"20E247","releasedate":"2023-03-27T00:00:00Z"}]}`))
+	})
+	day := func(s string) time.Time {
+		d, _ := time.Parse(time.DateOnly, s)
+		return d
+	}
+
+	tests := []struct {
+		name       string
+		buildID    string
+		wantOpened time.Time
+		wantClosed time.Time
+		wantSigned bool
+		wantErr    error
+	}{
+		{"closed by the nearest later release", "20A362", day("2022-09-12"), day("2022-10-24"), false, nil},
+		{"upload date fallback", "20D47", day("2023-01-23"), time.Time{}, true, nil},
+		{"no later release", "20E247", day("2023-03-27"), time.Time{}, false, nil},
+		{"unknown build", "99A1", time.Time{}, time.Time{}, false, ErrBuildNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opened, closed, signed, err := c.SigningWindow("iPhone15,2", tt.buildID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SigningWindow() error = %v, want %v", err, tt.wantErr)
+			}
+			if !opened.Equal(tt.wantOpened) || !closed.Equal(tt.wantClosed) || signed != tt.wantSigned {
+				t.Errorf("SigningWindow() = %s, %s, %t, want %s, %s, %t", opened, closed, signed, tt.wantOpened, tt.wantClosed, tt.wantSigned)
+			}
+		})
+	}
+}
+
+func TestPredictSigningDrop(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"identifier":"iPhone15,2","firmwares":[
+			{"version":"16.6","buildid":"20G75","signed":true},
+			{"version":"17.1","buildid":"21B74","signed":true},
+			{"version":"16.7 (a)","buildid":"20H19","signed":true},
+			{"version":"15.7","buildid":"19H12","signed":true},
+			{"version":"17.0","buildid":"21A329"},
+			{"version":"17.1","buildid":"21B80","signed":true}]}`))
+	})
+	got, err := c.PredictSigningDrop("iPhone15,2")
+	if err != nil {
+		t.Fatalf("PredictSigningDrop() error = %v", err)
+	}
+	var builds []string
+	for _, i := range got {
+		builds = append(builds, i.BuildID)
+	}
+	// oldest first, without the newest signed version (in any of its builds), unsigned or unparseable builds
+	if want := []string{"19H12", "20G75"}; !slices.Equal(builds, want) {
+		t.Errorf("PredictSigningDrop() = %v, want %v", builds, want)
+	}
+}
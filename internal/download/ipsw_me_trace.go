@@ -0,0 +1,37 @@
+package download
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// span attribute keys
+const (
+	attrEndpoint   = attribute.Key("ipsw.endpoint")
+	attrIdentifier = attribute.Key("ipsw.identifier")
+	attrBuild      = attribute.Key("ipsw.build")
+	attrStatus     = attribute.Key("http.response.status_code")
+	attrBytes      = attribute.Key("ipsw.download.bytes")
+)
+
+// startSpan starts a span as a child of any span in ctx when a tracer is set (see WithTracer),
+// otherwise it returns ctx untouched and a span that records nothing
+func (c *Client) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if c.tracer == nil {
+		return ctx, noop.Span{}
+	}
+	return c.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span recording err if the operation failed
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,151 @@
+package download
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed iOS version
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	Beta  int // 0 for non-beta versions
+}
+
+var versionRe = regexp.MustCompile(`(?i)^\s*(\d+)(?:\.(\d+))?(?:\.(\d+))?(\s*beta\s*(\d+)?)?\s*$`)
+
+// ParseVersion parses versions of the form 17, 17.2, 17.2.1 and 17.0 beta 3
+func ParseVersion(s string) (Version, error) {
+	m := versionRe.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, fmt.Errorf("failed to parse version %q", s)
+	}
+
+	atoi := func(p string) int {
+		if p == "" {
+			return 0
+		}
+		n, _ := strconv.Atoi(p) // the regex guarantees digits
+		return n
+	}
+
+	v := Version{
+		Major: atoi(m[1]),
+		Minor: atoi(m[2]),
+		Patch: atoi(m[3]),
+	}
+	if m[4] != "" {
+		v.Beta = max(atoi(m[5]), 1)
+	}
+
+	return v, nil
+}
+
+// Less returns whether v is older than o, betas are older than the release they precede
+func (v Version) Less(o Version) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor < o.Minor
+	}
+	if v.Patch != o.Patch {
+		return v.Patch < o.Patch
+	}
+	if v.Beta == 0 || o.Beta == 0 {
+		return v.Beta != 0 && o.Beta == 0
+	}
+	return v.Beta < o.Beta
+}
+
+// Compare returns -1 if v is older than o, 1 if it is newer and 0 if they are the same version
+func (v Version) Compare(o Version) int {
+	switch {
+	case v.Less(o):
+		return -1
+	case o.Less(v):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// versionPrefixRe matches the dotted numeric start of a version followed by anything (e.g. a build suffix)
+var versionPrefixRe = regexp.MustCompile(`^\s*(\d+(?:\.\d+){0,2})`)
+
+// CompareVersions compares two versions numerically returning -1 if a is older than b, 1 if it is newer
+// and 0 if they are the same version
+//
+// Missing components are zero so 16.3 equals 16.3.0, and anything after a version ParseVersion doesn't
+// accept (e.g. "16.3 (20D47)") is ignored. Versions without a numeric start are older than any other
+// and compared as strings between themselves.
+func CompareVersions(a, b string) int {
+	va, errA := parseVersionPrefix(a)
+	vb, errB := parseVersionPrefix(b)
+	switch {
+	case errA != nil && errB != nil:
+		return strings.Compare(a, b)
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	default:
+		return va.Compare(vb)
+	}
+}
+
+// parseVersionPrefix parses s with ParseVersion falling back to its dotted numeric start
+func parseVersionPrefix(s string) (Version, error) {
+	if v, err := ParseVersion(s); err == nil {
+		return v, nil
+	}
+	m := versionPrefixRe.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, fmt.Errorf("failed to parse version %q", s)
+	}
+	return ParseVersion(m[1])
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d", v.Major, v.Minor)
+	if v.Patch != 0 {
+		s += fmt.Sprintf(".%d", v.Patch)
+	}
+	if v.Beta != 0 {
+		s += fmt.Sprintf(" beta %d", v.Beta)
+	}
+	return s
+}
+
+// GetDeviceMajorVersions returns the distinct major versions a device has firmwares for using the DefaultClient
+func GetDeviceMajorVersions(identifier string) ([]int, error) {
+	return DefaultClient().GetDeviceMajorVersions(identifier)
+}
+
+// GetDeviceMajorVersions returns the distinct major versions a device has firmwares for sorted ascending
+//
+// Firmwares with an unparseable version are skipped.
+func (c *Client) GetDeviceMajorVersions(identifier string) ([]int, error) {
+	ipsws, err := c.GetDeviceIPSWs(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	majors := []int{}
+	for _, i := range ipsws {
+		v, err := ParseVersion(i.Version)
+		if err != nil {
+			continue
+		}
+		if !slices.Contains(majors, v.Major) {
+			majors = append(majors, v.Major)
+		}
+	}
+	slices.Sort(majors)
+
+	return majors, nil
+}